@@ -17,15 +17,27 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"os"
 	"runtime"
+	"strconv"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog"
+	klogv2 "k8s.io/klog/v2"
+	"k8s.io/klog/v2/klogr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -33,21 +45,20 @@ import (
 	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
 
 	apisv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+	"github.com/IBM/ibm-common-service-webhook/pkg/audit"
+	"github.com/IBM/ibm-common-service-webhook/pkg/config"
+	"github.com/IBM/ibm-common-service-webhook/pkg/controller/mutationpolicy"
+	"github.com/IBM/ibm-common-service-webhook/pkg/controller/namespacemapping"
 	"github.com/IBM/ibm-common-service-webhook/pkg/controller/nsmappingconfigmap"
 	"github.com/IBM/ibm-common-service-webhook/pkg/controller/operandrequest"
 	"github.com/IBM/ibm-common-service-webhook/pkg/controller/podpreset"
+	"github.com/IBM/ibm-common-service-webhook/pkg/nsmapping"
+	"github.com/IBM/ibm-common-service-webhook/pkg/tracing"
 	"github.com/IBM/ibm-common-service-webhook/pkg/utils"
 	"github.com/IBM/ibm-common-service-webhook/pkg/webhooks"
 	"github.com/IBM/ibm-common-service-webhook/version"
 )
 
-// Change below variables to serve metrics on different host or port.
-var (
-	metricsHost               = "0.0.0.0"
-	metricsPort         int32 = 8383
-	operatorMetricsPort int32 = 8686
-)
-
 func printVersion() {
 	klog.Infof("Operator Version: %s", version.Version)
 	klog.Infof("Go Version: %s", runtime.Version())
@@ -70,12 +81,64 @@ func main() {
 	klog.InitFlags(nil)
 	defer klog.Flush()
 
+	// The webhook and controller packages log through controller-runtime's
+	// logr logger, backed by klog/v2. Its flags, e.g. -v, are kept in sync
+	// with the klog ones, so per-admission lines are enabled with -v=1
+	klogv2Flags := flag.NewFlagSet("klogv2", flag.ExitOnError)
+	klogv2.InitFlags(klogv2Flags)
+	managerConfig := config.Default()
+	managerConfig.BindFlags(flag.CommandLine)
+	configFile := flag.String("config", "", "Path of the manager configuration file. The flags take precedence over it")
+	flag.Parse()
+	if err := loadConfig(managerConfig, *configFile); err != nil {
+		klog.Errorf("invalid configuration: %v", err)
+		os.Exit(1)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if v2Flag := klogv2Flags.Lookup(f.Name); v2Flag != nil {
+			utilruntime.Must(v2Flag.Value.Set(f.Value.String()))
+		}
+	})
+	defer klogv2.Flush()
+	ctrl.SetLogger(klogr.New())
+
 	printVersion()
 
-	namespace := utils.GetWatchNamespace()
+	namespace := managerConfig.Server.Namespace
 	options := ctrl.Options{
-		Scheme:    scheme,
-		Namespace: namespace,
+		Scheme: scheme,
+		// The objects read by the controllers outside of the watched namespaces,
+		// and the cluster-scoped ones, bypass the cache
+		ClientDisableCacheFor: []client.Object{
+			&corev1.Namespace{},
+			&corev1.Service{},
+			&corev1.ConfigMap{},
+			&admissionregistrationv1.MutatingWebhookConfiguration{},
+			&admissionregistrationv1.ValidatingWebhookConfiguration{},
+			&apisv1alpha1.MutationPolicy{},
+			&apisv1alpha1.CommonServiceNamespaceMapping{},
+		},
+		// Only the leader runs the controllers, which reconcile the namespaces
+		// and the webhook configurations. The webhook server doesn't need
+		// leader election, so every replica serves the admission requests
+		LeaderElection:                true,
+		LeaderElectionID:              "ibm-common-service-webhook-lock",
+		LeaderElectionNamespace:       namespace,
+		LeaderElectionReleaseOnCancel: true,
+		HealthProbeBindAddress:        managerConfig.HealthProbeBindAddress,
+		MetricsBindAddress:            managerConfig.MetricsBindAddress,
+	}
+	// The PodPresets are watched in a single namespace, a list of namespaces
+	// or all of them
+	switch watchNamespaces := managerConfig.WatchNamespaces; len(watchNamespaces) {
+	case 0:
+		klog.Info("Watching all namespaces")
+	case 1:
+		klog.Infof("Watching namespace %s", watchNamespaces[0])
+		options.Namespace = watchNamespaces[0]
+	default:
+		klog.Infof("Watching namespaces %v", watchNamespaces)
+		options.NewCache = cache.MultiNamespacedCacheBuilder(watchNamespaces)
 	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
@@ -91,37 +154,155 @@ func main() {
 
 	klog.Info("Registering Components.")
 
+	webhookConfig := webhooks.NewCSWebhookConfig(managerConfig.Server)
+	// The webhook configurations of the MutationPolicies would point to a path
+	// that isn't served, so they are pruned when the feature is disabled
+	webhookConfig.PruneDynamicWebhooks = !managerConfig.Webhooks.MutationPolicy
+
+	// The namespace mapping webhook can be switched on at runtime, so its
+	// namespace is labeled even if it's disabled
 	if err = (&podpreset.ReconcilePodPreset{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WebhookConfig:    webhookConfig,
+		MappingNamespace: managerConfig.NamespaceMapping.Namespace,
+	}).SetupWithManager(mgr); err != nil {
+		klog.Errorf("unable to create controller: %v", err)
+		os.Exit(1)
+	}
+	if err = (&namespacemapping.ReconcileNamespaceMapping{
+		Client:      mgr.GetClient(),
+		Name:        managerConfig.NamespaceMapping.Name,
+		DefaultCsNs: managerConfig.DefaultCsNamespace,
 	}).SetupWithManager(mgr); err != nil {
 		klog.Errorf("unable to create controller: %v", err)
 		os.Exit(1)
 	}
+	if managerConfig.Webhooks.MutationPolicy {
+		if err = mutationpolicy.CheckServerVersion(mgr.GetConfig()); err != nil {
+			klog.Errorf("unable to enable the MutationPolicies: %v", err)
+			os.Exit(1)
+		}
+		if err = (&mutationpolicy.ReconcileMutationPolicy{
+			Client:        mgr.GetClient(),
+			Scheme:        mgr.GetScheme(),
+			RESTMapper:    mgr.GetRESTMapper(),
+			WebhookConfig: webhookConfig,
+		}).SetupWithManager(mgr); err != nil {
+			klog.Errorf("unable to create controller: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	mappings, err := setupNamespaceMapping(mgr, managerConfig)
+	if err != nil {
+		klog.Errorf("unable to set up namespace mapping cache: %v", err)
+		os.Exit(1)
+	}
+	if managerConfig.NamespaceMapping.Remap != config.RemapDisabled {
+		if err = (&operandrequest.ReconcileOperandRequest{
+			Client:      mgr.GetClient(),
+			Reader:      mgr.GetAPIReader(),
+			Recorder:    mgr.GetEventRecorderFor("ibm-common-service-webhook"),
+			Mappings:    mappings,
+			DefaultCsNs: managerConfig.DefaultCsNamespace,
+			DryRun:      managerConfig.NamespaceMapping.Remap == config.RemapDryRun,
+		}).SetupWithManager(mgr); err != nil {
+			klog.Errorf("unable to create controller: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	audit.DefaultTrail.Configure(utils.GetAuditTrailSize(), utils.GetAuditLogEnabled())
 
 	// Start up the webhook server
-	if err := setupWebhooks(mgr, namespace); err != nil {
+	if err := setupWebhooks(mgr, managerConfig, webhookConfig, mappings); err != nil {
 		klog.Error(err, "Error setting up webhook server")
 	}
 
+	if err := setupSwitches(mgr, managerConfig, webhookConfig); err != nil {
+		klog.Errorf("unable to set up webhook switches: %v", err)
+		os.Exit(1)
+	}
+
+	if err := setupHealthChecks(mgr, webhookConfig, mappings); err != nil {
+		klog.Errorf("unable to set up health checks: %v", err)
+		os.Exit(1)
+	}
+
+	// Tracing of the admission requests is disabled unless an exporter is set
+	shutdownTracing, err := tracing.Setup(context.Background(), utils.GetTracesExporter(), utils.GetTracesFile())
+	if err != nil {
+		klog.Errorf("unable to set up tracing: %v", err)
+		os.Exit(1)
+	}
+
 	klog.Info("Starting the Cmd.")
 
 	// Start the Cmd
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	err = mgr.Start(signals.SetupSignalHandler())
+	if shutdownErr := shutdownTracing(context.Background()); shutdownErr != nil {
+		klog.Errorf("unable to flush traces: %v", shutdownErr)
+	}
+	if err != nil {
 		klog.Error(err, "Manager exited non-zero")
 		os.Exit(1)
 	}
 }
 
-func setupWebhooks(mgr manager.Manager, namespace string) error {
+// loadConfig loads the configuration file, if it's set, and validates the
+// configuration. The flags set on the command line are parsed again, so they
+// take precedence over the file, and the log level of the file is applied
+// unless -v is set
+func loadConfig(managerConfig *config.ManagerConfiguration, configFile string) error {
+	if configFile != "" {
+		if err := managerConfig.LoadFile(configFile); err != nil {
+			return err
+		}
+		if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+			return err
+		}
+	}
+
+	if err := managerConfig.Validate(); err != nil {
+		return err
+	}
+
+	verbositySet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "v" {
+			verbositySet = true
+		}
+	})
+	if !verbositySet && managerConfig.LogLevel > 0 {
+		return flag.Set("v", strconv.Itoa(managerConfig.LogLevel))
+	}
+	return nil
+}
+
+func setupWebhooks(mgr manager.Manager, managerConfig *config.ManagerConfiguration, webhookConfig *webhooks.CSWebhookConfig, mappings *nsmapping.Cache) error {
 
 	klog.Info("Creating common service webhook configuration")
-	managedbyCSWebhookLabel := make(map[string]string)
-	managedbyCSWebhookLabel["managed-by-common-service-webhook"] = "true"
+	// The namespaces with PodPresets are labeled with the labels of the
+	// instance by the PodPreset controller
 	managedbyCSSelector := v1.LabelSelector{
-		MatchLabels: managedbyCSWebhookLabel,
+		MatchLabels: webhookConfig.Labels,
+	}
+	// Exclude the operator own pods and the pods that opt out from the webhook
+	podObjectSelector := v1.LabelSelector{
+		MatchExpressions: append(webhookConfig.OwnPodsExclusion(), v1.LabelSelectorRequirement{
+			Key:      podpreset.OptOutLabelKey,
+			Operator: v1.LabelSelectorOpNotIn,
+			Values: []string{
+				"true",
+			},
+		}),
 	}
-	webhooks.Config.AddWebhook(webhooks.CSWebhook{
+	// Reinvoke the pod mutator when other mutating webhooks add containers
+	podReinvocationPolicy := admissionregistrationv1.IfNeededReinvocationPolicy
+	// The webhooks are always served, and the disabled ones are switched on at
+	// runtime from the switches ConfigMap
+	webhookConfig.AddWebhook(webhooks.CSWebhook{
 		Name:        "ibm-common-service-webhook-configuration",
 		WebhookName: "cs-podpreset.operator.ibm.com",
 		Rule: webhooks.NewRule().
@@ -138,62 +319,220 @@ func setupWebhooks(mgr manager.Manager, namespace string) error {
 				},
 			},
 		},
-		NsSelector: managedbyCSSelector,
+		NsSelector:         managedbyCSSelector,
+		ObjectSelector:     podObjectSelector,
+		ReinvocationPolicy: &podReinvocationPolicy,
+		Switch:             config.PodPresetSwitch,
+		Disabled:           !managerConfig.Webhooks.PodPreset,
 	})
-	if utils.GetEnableOpreqWebhook() {
-		webhooks.Config.AddWebhook(webhooks.CSWebhook{
-			Name:        "ibm-operandrequest-webhook-configuration",
-			WebhookName: "ibm-cloudpak-operandrequest.operator.ibm.com",
-			Rule: webhooks.NewRule().
-				OneResource("operator.ibm.com", "v1alpha1", "operandrequests").
-				ForUpdate().
-				ForCreate().
-				NamespacedScope(),
-			Register: webhooks.AdmissionWebhookRegister{
-				Type: webhooks.MutatingType,
-				Path: "/mutate-ibm-cp-operandrequest",
-				Hook: &admission.Webhook{
-					Handler: &operandrequest.Mutator{
-						Reader: mgr.GetAPIReader(),
-					},
+	webhookConfig.AddWebhook(webhooks.CSWebhook{
+		Name:        "ibm-operandrequest-webhook-configuration",
+		WebhookName: "ibm-cloudpak-operandrequest.operator.ibm.com",
+		Rule: webhooks.NewRule().
+			OneResource("operator.ibm.com", "v1alpha1", "operandrequests").
+			ForUpdate().
+			ForCreate().
+			NamespacedScope(),
+		Register: webhooks.AdmissionWebhookRegister{
+			Type: webhooks.MutatingType,
+			Path: "/mutate-ibm-cp-operandrequest",
+			Hook: &admission.Webhook{
+				Handler: &operandrequest.Mutator{
+					Reader:      mgr.GetAPIReader(),
+					Mappings:    mappings,
+					DefaultCsNs: managerConfig.DefaultCsNamespace,
 				},
 			},
-		})
-		webhooks.Config.AddWebhook(webhooks.CSWebhook{
-			Name:        "ibm-cs-ns-mapping-webhook-configuration",
-			WebhookName: "cs-ns-mapping-configmap.operator.ibm.com",
-			Rule: webhooks.NewRule().
-				OneResource("", "v1", "configmaps").
-				ForUpdate().
-				ForCreate().
-				NamespacedScope(),
-			Register: webhooks.AdmissionWebhookRegister{
-				Type: webhooks.ValidatingType,
-				Path: "/validate-ibm-cs-ns-map",
-				Hook: &admission.Webhook{
-					Handler: &nsmappingconfigmap.Mutator{
-						Reader: mgr.GetAPIReader(),
-					},
+		},
+		Switch:   config.OperandRequestSwitch,
+		Disabled: !managerConfig.Webhooks.OperandRequest,
+	})
+	// The namespace mapping validator can fail open, e.g. in dev clusters
+	nsMappingFailurePolicy := managerConfig.NamespaceMapping.FailurePolicy
+	// Validating webhooks are called after the mutating ones, so the
+	// OperandRequests are validated once rewritten by the mapping. The
+	// validator has its own failure policy, as it's called on every
+	// OperandRequest instead of the mapping only
+	requestValidationFailurePolicy := managerConfig.NamespaceMapping.RequestValidationFailurePolicy
+	webhookConfig.AddWebhook(webhooks.CSWebhook{
+		Name:        "ibm-operandrequest-validating-webhook-configuration",
+		WebhookName: "ibm-cloudpak-operandrequest-validation.operator.ibm.com",
+		Rule: webhooks.NewRule().
+			OneResource("operator.ibm.com", "v1alpha1", "operandrequests").
+			ForUpdate().
+			ForCreate().
+			NamespacedScope(),
+		Register: webhooks.AdmissionWebhookRegister{
+			Type: webhooks.ValidatingType,
+			Path: "/validate-ibm-cp-operandrequest",
+			Hook: &admission.Webhook{
+				Handler: &operandrequest.Validator{
+					Reader:      mgr.GetAPIReader(),
+					Mappings:    mappings,
+					DefaultCsNs: managerConfig.DefaultCsNamespace,
+				},
+			},
+		},
+		FailurePolicy: &requestValidationFailurePolicy,
+		Switch:        config.OperandRequestValidationSwitch,
+		Disabled:      !managerConfig.Webhooks.OperandRequestValidation,
+	})
+	webhookConfig.AddWebhook(webhooks.CSWebhook{
+		Name:        "ibm-cs-ns-mapping-webhook-configuration",
+		WebhookName: "cs-ns-mapping-configmap.operator.ibm.com",
+		Rule: webhooks.NewRule().
+			OneResource("", "v1", "configmaps").
+			ForUpdate().
+			ForCreate().
+			ForDelete().
+			NamespacedScope(),
+		Register: webhooks.AdmissionWebhookRegister{
+			Type: webhooks.ValidatingType,
+			Path: "/validate-ibm-cs-ns-map",
+			Hook: &admission.Webhook{
+				Handler: &nsmappingconfigmap.Mutator{
+					Reader:           mgr.GetAPIReader(),
+					MappingConfigMap: managerConfig.NamespaceMapping.ConfigMapKey(),
+					DefaultCsNs:      managerConfig.DefaultCsNamespace,
+					RemapsRequests:   managerConfig.NamespaceMapping.Remap == config.RemapPatch,
 				},
 			},
-			NsSelector: v1.LabelSelector{
-				MatchExpressions: []v1.LabelSelectorRequirement{
-					{
-						Key:      "kubernetes.io/metadata.name",
-						Operator: v1.LabelSelectorOpIn,
-						Values: []string{
-							"kube-public",
-						},
+		},
+		FailurePolicy: &nsMappingFailurePolicy,
+		NsSelector: v1.LabelSelector{
+			MatchExpressions: []v1.LabelSelectorRequirement{
+				{
+					Key:      "kubernetes.io/metadata.name",
+					Operator: v1.LabelSelectorOpIn,
+					Values: []string{
+						managerConfig.NamespaceMapping.Namespace,
 					},
 				},
 			},
-		})
-	}
+		},
+		Switch:   config.NamespaceMappingSwitch,
+		Disabled: !managerConfig.Webhooks.NamespaceMapping,
+	})
+	webhookConfig.AddWebhook(webhooks.CSWebhook{
+		Name:        "ibm-cs-ns-mapping-webhook-configuration",
+		WebhookName: "cs-ns-mapping.operator.ibm.com",
+		Rule: webhooks.NewRule().
+			OneResource("operator.ibm.com", "v1alpha1", "commonservicenamespacemappings").
+			ForUpdate().
+			ForCreate().
+			ForDelete().
+			ClusterScope(),
+		Register: webhooks.AdmissionWebhookRegister{
+			Type: webhooks.ValidatingType,
+			Path: "/validate-ibm-cs-ns-mapping",
+			Hook: &admission.Webhook{
+				Handler: &namespacemapping.Validator{
+					Reader:         mgr.GetAPIReader(),
+					Name:           managerConfig.NamespaceMapping.Name,
+					DefaultCsNs:    managerConfig.DefaultCsNamespace,
+					RemapsRequests: managerConfig.NamespaceMapping.Remap == config.RemapPatch,
+				},
+			},
+		},
+		FailurePolicy: &nsMappingFailurePolicy,
+		Switch:        config.NamespaceMappingSwitch,
+		Disabled:      !managerConfig.Webhooks.NamespaceMapping,
+	})
 
 	klog.Info("setting up webhook server")
-	if err := webhooks.Config.SetupServer(mgr, namespace); err != nil {
+	if err := webhookConfig.SetupServer(mgr); err != nil {
 		return err
 	}
 
+	if managerConfig.Webhooks.MutationPolicy {
+		policies, err := mutationpolicy.NewCache(mgr)
+		if err != nil {
+			return err
+		}
+		// A single handler serves every MutationPolicy under its path prefix.
+		// Their webhook configurations are reconciled by the MutationPolicy
+		// controller, so policies are added without restarting the server
+		webhooks.AdmissionWebhookRegister{
+			Type: webhooks.MutatingType,
+			Path: mutationpolicy.PathPrefix,
+			Hook: &admission.Webhook{
+				Handler: &mutationpolicy.Mutator{
+					Reader: policies,
+					Scheme: mgr.GetScheme(),
+				},
+				WithContextFunc: mutationpolicy.WithPolicyName,
+			},
+		}.RegisterToServer(mgr.GetScheme(), mgr.GetWebhookServer())
+	}
+
 	return nil
 }
+
+// setupNamespaceMapping returns the cache of the namespace mapping read by the
+// webhooks, which is started with the manager
+func setupNamespaceMapping(mgr manager.Manager, managerConfig *config.ManagerConfiguration) (*nsmapping.Cache, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := &nsmapping.Cache{
+		Name:       managerConfig.NamespaceMapping.Name,
+		ConfigMap:  managerConfig.NamespaceMapping.ConfigMapKey(),
+		Clientset:  clientset,
+		Dynamic:    dynamicClient,
+		RESTMapper: mgr.GetRESTMapper(),
+	}
+	return mappings, mgr.Add(mappings)
+}
+
+// setupSwitches watches the switches ConfigMap, if it's set, to enable and
+// disable the webhooks at runtime
+func setupSwitches(mgr manager.Manager, managerConfig *config.ManagerConfiguration, webhookConfig *webhooks.CSWebhookConfig) error {
+	if managerConfig.Webhooks.SwitchesConfigMap == "" {
+		return nil
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	// The webhook configurations are reconciled before the cache is synced
+	uncachedClient, err := client.New(mgr.GetConfig(), client.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return mgr.Add(&webhooks.SwitchesWatcher{
+		WebhookConfig: webhookConfig,
+		ConfigMap:     managerConfig.Webhooks.SwitchesConfigMap,
+		Clientset:     clientset,
+		Client:        uncachedClient,
+		Elected:       mgr.Elected(),
+	})
+}
+
+// setupHealthChecks adds the readiness checks, so admission traffic is only
+// routed to the pod once the webhook server can serve it, and a liveness check
+func setupHealthChecks(mgr manager.Manager, webhookConfig *webhooks.CSWebhookConfig, mappings *nsmapping.Cache) error {
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("certs", webhookConfig.CertsChecker()); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("webhook-server", webhookConfig.ServerChecker()); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("namespace-mapping", mappings.Checker()); err != nil {
+		return err
+	}
+	return mgr.AddReadyzCheck("cache", webhooks.CacheSyncChecker(mgr.GetCache(), &apisv1alpha1.PodPreset{}))
+}
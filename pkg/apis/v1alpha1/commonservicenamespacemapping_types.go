@@ -0,0 +1,136 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceMapping maps the namespaces of a tenant to the Common Services
+// namespace that serves their OperandRequests
+type NamespaceMapping struct {
+	// RequestedFromNamespaces are the namespaces of the tenant. They may be
+	// glob patterns, where "*" matches any sequence of characters and "?" any
+	// single character
+	// +optional
+	// +kubebuilder:validation:items:MaxLength=63
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9*?]([-a-z0-9*?]*[a-z0-9*?])?$`
+	RequestedFromNamespaces []string `json:"requestedFromNamespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces of the tenant by their labels,
+	// in addition to RequestedFromNamespaces. The namespaces matched by name
+	// take precedence over the selected ones
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// MapToCommonServiceNamespace is the Common Services namespace of the
+	// tenant
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	MapToCommonServiceNamespace string `json:"mapToCommonServiceNamespace"`
+
+	// Rewrite configures the fields of the OperandRequests rewritten in
+	// addition to their registryNamespace
+	// +optional
+	Rewrite *RequestRewrite `json:"rewrite,omitempty"`
+}
+
+// RequestRewrite configures the fields of the requests rewritten along with
+// their registryNamespace. The original values are recorded in an annotation
+// of the OperandRequest
+type RequestRewrite struct {
+	// Registries renames the OperandRegistries, from their name in the default
+	// Common Services namespace to their name in the one of the tenant
+	// +optional
+	Registries map[string]string `json:"registries,omitempty"`
+
+	// Bindings renames the secrets and configmaps of the bindings of the
+	// operands
+	// +optional
+	Bindings map[string]string `json:"bindings,omitempty"`
+
+	// OperandNamespaces rewrites the values of the spec of the operands that
+	// are the default Common Services namespace to the one of the tenant
+	// +optional
+	OperandNamespaces bool `json:"operandNamespaces,omitempty"`
+}
+
+// CommonServiceNamespaceMappingSpec defines the desired state of
+// CommonServiceNamespaceMapping
+// +k8s:openapi-gen=true
+type CommonServiceNamespaceMappingSpec struct {
+	// ControlNamespace is the namespace of the shared control plane. It can't
+	// be a requested-from or a Common Services namespace
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	ControlNamespace string `json:"controlNamespace,omitempty"`
+
+	// DefaultCsNamespace is the registry namespace of the OperandRequests that
+	// is rewritten. Defaults to the one set in the manager configuration
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	DefaultCsNamespace string `json:"defaultCsNamespace,omitempty"`
+
+	// NamespaceMappings of the tenants
+	// +optional
+	NamespaceMappings []NamespaceMapping `json:"namespaceMappings,omitempty"`
+}
+
+// CommonServiceNamespaceMappingStatus defines the observed state of
+// CommonServiceNamespaceMapping
+type CommonServiceNamespaceMappingStatus struct {
+	// ObservedGeneration is the generation of the mapping the status refers to
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions of the mapping. The Valid condition is false when the mapping
+	// was created without being validated, e.g. with the webhook disabled
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CommonServiceNamespaceMapping is the Schema for the
+// commonservicenamespacemappings API. It replaces the common-service-maps
+// ConfigMap, and only the one named as the ConfigMap is used
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=commonservicenamespacemappings,scope=Cluster,shortName=csnsmap
+type CommonServiceNamespaceMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CommonServiceNamespaceMappingSpec   `json:"spec,omitempty"`
+	Status CommonServiceNamespaceMappingStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CommonServiceNamespaceMappingList contains a list of
+// CommonServiceNamespaceMapping
+type CommonServiceNamespaceMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CommonServiceNamespaceMapping `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CommonServiceNamespaceMapping{}, &CommonServiceNamespaceMappingList{})
+}
@@ -0,0 +1,129 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MutationPatchType is the type of a MutationPatch
+// +kubebuilder:validation:Enum=JSONPatch;StrategicMerge
+type MutationPatchType string
+
+const (
+	// JSONPatchType is a RFC 6902 JSON patch, a list of operations
+	JSONPatchType MutationPatchType = "JSONPatch"
+
+	// StrategicMergePatchType is a fragment of the object merged with the
+	// strategic merge patch semantics of its kind
+	StrategicMergePatchType MutationPatchType = "StrategicMerge"
+)
+
+// MutationTarget is the kind of the objects mutated by a MutationPolicy
+type MutationTarget struct {
+	// Group of the objects, empty for the core group
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Version of the objects
+	Version string `json:"version"`
+
+	// Kind of the objects
+	Kind string `json:"kind"`
+}
+
+// MutationPatch is a patch applied to the objects mutated by a MutationPolicy
+type MutationPatch struct {
+	// Type of the patch, JSONPatch or StrategicMerge
+	Type MutationPatchType `json:"type"`
+
+	// Patch is the list of JSON patch operations, or the strategic merge
+	// fragment of the object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Patch runtime.RawExtension `json:"patch"`
+}
+
+// MutationPolicySpec defines the desired state of MutationPolicy
+// +k8s:openapi-gen=true
+type MutationPolicySpec struct {
+	// Target is the kind of the objects mutated by the policy
+	Target MutationTarget `json:"target"`
+
+	// Operations that trigger the mutation, CREATE or UPDATE. Defaults to
+	// CREATE
+	// +optional
+	// +kubebuilder:validation:items:Enum=CREATE;UPDATE
+	Operations []admissionregistrationv1.OperationType `json:"operations,omitempty"`
+
+	// NamespaceSelector selects the namespaces of the mutated objects. Defaults
+	// to all the namespaces
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// ObjectSelector selects the mutated objects by their labels. Defaults to
+	// all the objects
+	// +optional
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+
+	// FailurePolicy of the webhook. Defaults to Ignore
+	// +optional
+	FailurePolicy *admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// Patches applied in order to the mutated objects
+	Patches []MutationPatch `json:"patches"`
+}
+
+// MutationPolicyStatus defines the observed state of MutationPolicy
+type MutationPolicyStatus struct {
+	// ObservedGeneration is the generation of the policy the status refers to
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions of the policy. The Ready condition is true once its webhook
+	// configuration is reconciled
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MutationPolicy is the Schema for the mutationpolicies API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=mutationpolicies,scope=Cluster
+type MutationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MutationPolicySpec   `json:"spec,omitempty"`
+	Status MutationPolicyStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MutationPolicyList contains a list of MutationPolicy
+type MutationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MutationPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MutationPolicy{}, &MutationPolicyList{})
+}
@@ -0,0 +1,215 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package audit keeps a trail of the mutations applied by the webhooks: the
+// JSON patch of each admission, the objects responsible for it and the user
+// that sent the request.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// DefaultSize is the number of records kept by the trail unless configured
+const DefaultSize = 1000
+
+// Record is the audit record of a mutation applied by a webhook
+type Record struct {
+	Time         time.Time       `json:"time"`
+	UID          string          `json:"uid"`
+	Webhook      string          `json:"webhook"`
+	Kind         string          `json:"kind"`
+	Namespace    string          `json:"namespace"`
+	Name         string          `json:"name,omitempty"`
+	GenerateName string          `json:"generateName,omitempty"`
+	Operation    string          `json:"operation"`
+	User         string          `json:"user"`
+	Groups       []string        `json:"groups,omitempty"`
+	Patch        json.RawMessage `json:"patch"`
+	// Reasons are the objects responsible for the mutation, e.g. the
+	// PodPresets applied to a pod
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Trail is a bounded ring buffer of audit records, dropping the oldest record
+// when it's full
+type Trail struct {
+	mu          sync.RWMutex
+	records     []Record
+	next        int
+	full        bool
+	mirrorToLog bool
+}
+
+// DefaultTrail is the trail the webhooks record their mutations to
+var DefaultTrail = NewTrail(DefaultSize)
+
+// NewTrail creates a trail that keeps the last size records
+func NewTrail(size int) *Trail {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Trail{
+		records: make([]Record, size),
+	}
+}
+
+// Configure resizes the trail, dropping the records it has, and sets whether
+// the records are mirrored as log lines
+func (t *Trail) Configure(size int, mirrorToLog bool) {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records = make([]Record, size)
+	t.next = 0
+	t.full = false
+	t.mirrorToLog = mirrorToLog
+}
+
+// Add appends a record to the trail
+func (t *Trail) Add(record Record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.records[t.next] = record
+	t.next = (t.next + 1) % len(t.records)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// Records returns the records of the trail matching filter, oldest first
+func (t *Trail) Records(filter func(Record) bool) []Record {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ordered := t.records[:t.next]
+	if t.full {
+		ordered = append(append([]Record{}, t.records[t.next:]...), t.records[:t.next]...)
+	}
+
+	result := []Record{}
+	for _, record := range ordered {
+		if filter == nil || filter(record) {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+func (t *Trail) mirrorsToLog() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.mirrorToLog
+}
+
+type entryKey struct{}
+
+// entry collects the reasons of a mutation while the admission is handled
+type entry struct {
+	mu           sync.Mutex
+	generateName string
+	reasons      []string
+}
+
+// AddReason records an object responsible for the mutation of the admission
+// request in ctx, e.g. "podpreset ibm-common-services/ibm-common-service-webhook"
+func AddReason(ctx context.Context, reason string) {
+	if e, ok := ctx.Value(entryKey{}).(*entry); ok {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.reasons = append(e.reasons, reason)
+	}
+}
+
+// SetGenerateName records the generateName of the object of the admission
+// request in ctx, as objects like pods are only named after the admission
+func SetGenerateName(ctx context.Context, generateName string) {
+	if e, ok := ctx.Value(entryKey{}).(*entry); ok {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.generateName = generateName
+	}
+}
+
+// AuditedHandler records the admission requests patched by Handler into Trail
+// +k8s:deepcopy-gen=false
+type AuditedHandler struct {
+	Name    string
+	Handler admission.Handler
+	Trail   *Trail
+}
+
+// Handle calls the wrapped handler and records its patch, if any
+func (h *AuditedHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	e := &entry{}
+	resp := h.Handler.Handle(context.WithValue(ctx, entryKey{}, e), req)
+	if !resp.Allowed || len(resp.Patches) == 0 {
+		return resp
+	}
+
+	patch, err := json.Marshal(resp.Patches)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to marshal the patch for the audit trail")
+		return resp
+	}
+
+	e.mu.Lock()
+	record := Record{
+		Time:         time.Now().UTC(),
+		UID:          string(req.UID),
+		Webhook:      h.Name,
+		Kind:         req.Kind.Kind,
+		Namespace:    req.Namespace,
+		Name:         req.Name,
+		GenerateName: e.generateName,
+		Operation:    string(req.Operation),
+		User:         req.UserInfo.Username,
+		Groups:       req.UserInfo.Groups,
+		Patch:        patch,
+		Reasons:      e.reasons,
+	}
+	e.mu.Unlock()
+
+	h.Trail.Add(record)
+	if h.Trail.mirrorsToLog() {
+		logf.FromContext(ctx).Info("Audit", "user", record.User, "groups", record.Groups,
+			"patch", string(record.Patch), "reasons", record.Reasons)
+	}
+
+	return resp
+}
+
+// InjectDecoder injects the decoder into the wrapped handler
+func (h *AuditedHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
+// InjectFunc injects the dependencies into the wrapped handler
+func (h *AuditedHandler) InjectFunc(f inject.Func) error {
+	return f(h.Handler)
+}
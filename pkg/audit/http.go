@@ -0,0 +1,115 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Path is the path of the webhook server the audit trail is served at
+const Path = "/audit"
+
+var log = logf.Log.WithName("audit")
+
+// HTTPHandler serves the records of Trail as JSON. The requests are
+// authenticated with a bearer token through a TokenReview, and the user must
+// be allowed to get the Path non-resource URL. The records can be filtered
+// with the `namespace`, `name` and `uid` query parameters, where `name` also
+// matches the generateName of the object
+type HTTPHandler struct {
+	Client client.Client
+	Trail  *Trail
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		http.Error(w, "a bearer token is required", http.StatusUnauthorized)
+		return
+	}
+
+	tokenReview := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}
+	if err := h.Client.Create(r.Context(), tokenReview); err != nil {
+		log.Error(err, "Failed to review the token of an audit request")
+		http.Error(w, "failed to authenticate the request", http.StatusInternalServerError)
+		return
+	}
+	if !tokenReview.Status.Authenticated {
+		http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	user := tokenReview.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	accessReview := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: Path,
+				Verb: "get",
+			},
+		},
+	}
+	if err := h.Client.Create(r.Context(), accessReview); err != nil {
+		log.Error(err, "Failed to review the access of an audit request")
+		http.Error(w, "failed to authorize the request", http.StatusInternalServerError)
+		return
+	}
+	if !accessReview.Status.Allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	namespace, name, uid := query.Get("namespace"), query.Get("name"), query.Get("uid")
+	records := h.Trail.Records(func(record Record) bool {
+		if namespace != "" && record.Namespace != namespace {
+			return false
+		}
+		if name != "" && record.Name != name && (record.GenerateName == "" || !strings.HasPrefix(name, record.GenerateName)) {
+			return false
+		}
+		return uid == "" || record.UID == uid
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		log.Error(err, "Failed to write the audit records")
+	}
+}
@@ -0,0 +1,345 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package config defines the configuration of the manager. It's read from a
+// versioned configuration file, and every setting can be overridden by a flag.
+// The defaults keep honoring the environment variables of the deployment.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	utilyaml "github.com/ghodss/yaml"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/utils"
+	"github.com/IBM/ibm-common-service-webhook/pkg/webhooks"
+)
+
+const (
+	// APIVersion of the configuration file
+	APIVersion = "webhook.operator.ibm.com/v1alpha1"
+
+	// Kind of the configuration file
+	Kind = "ManagerConfiguration"
+)
+
+// ManagerConfiguration is the configuration of the manager
+// +k8s:deepcopy-gen=false
+type ManagerConfiguration struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// WatchNamespaces are the namespaces watched by the manager cache, all
+	// the namespaces when it's empty
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// Webhooks that are enabled, until they are switched at runtime
+	Webhooks WebhooksConfiguration `json:"webhooks"`
+
+	// Server is the configuration of the webhook server, its Service and its
+	// certificates
+	Server webhooks.Options `json:"server"`
+
+	// MetricsBindAddress is the address the metrics endpoint binds to, "0"
+	// disables it
+	MetricsBindAddress string `json:"metricsBindAddress"`
+
+	// HealthProbeBindAddress is the address the health probes bind to
+	HealthProbeBindAddress string `json:"healthProbeBindAddress"`
+
+	// DefaultCsNamespace is the registry namespace of the OperandRequests that
+	// is rewritten, unless the mapping ConfigMap sets its own defaultCsNs
+	DefaultCsNamespace string `json:"defaultCsNamespace"`
+
+	// NamespaceMapping is the location of the common service namespace
+	// mapping ConfigMap
+	NamespaceMapping NamespaceMappingConfiguration `json:"namespaceMapping"`
+
+	// LogLevel is the verbosity of the logs, as set by -v
+	LogLevel int `json:"logLevel"`
+}
+
+// WebhooksConfiguration enables each of the webhooks. The pod, OperandRequest
+// and namespace mapping webhooks, and the OperandRequest validator, can be
+// switched at runtime from the switches ConfigMap, whose keys are the JSON
+// names of their settings
+// +k8s:deepcopy-gen=false
+type WebhooksConfiguration struct {
+	// PodPreset enables the pod mutating webhook
+	PodPreset bool `json:"podPreset"`
+
+	// OperandRequest enables the OperandRequest mutating webhook
+	OperandRequest bool `json:"operandRequest"`
+
+	// NamespaceMapping enables the namespace mapping ConfigMap validating webhook
+	NamespaceMapping bool `json:"namespaceMapping"`
+
+	// OperandRequestValidation enables the OperandRequest validating webhook,
+	// which denies the requests to the Common Services namespace of another
+	// tenant
+	OperandRequestValidation bool `json:"operandRequestValidation"`
+
+	// MutationPolicy enables the MutationPolicy controller and webhook
+	MutationPolicy bool `json:"mutationPolicy"`
+
+	// SwitchesConfigMap is the name of the ConfigMap, in the namespace of the
+	// webhook server, that switches the webhooks at runtime. Runtime switches
+	// are disabled when it's empty
+	SwitchesConfigMap string `json:"switchesConfigMap"`
+}
+
+// Keys of the switches ConfigMap
+const (
+	PodPresetSwitch                = "podPreset"
+	OperandRequestSwitch           = "operandRequest"
+	NamespaceMappingSwitch         = "namespaceMapping"
+	OperandRequestValidationSwitch = "operandRequestValidation"
+)
+
+// NamespaceMappingConfiguration is the location of the namespace mapping
+// ConfigMap, the failure policy of its validating webhook and of the
+// OperandRequest validating webhook, and how the existing OperandRequests are
+// re-mapped when it changes. The CommonServiceNamespaceMapping that replaces
+// the ConfigMap has the same name
+// +k8s:deepcopy-gen=false
+type NamespaceMappingConfiguration struct {
+	Namespace     string                                    `json:"namespace"`
+	Name          string                                    `json:"name"`
+	FailurePolicy admissionregistrationv1.FailurePolicyType `json:"failurePolicy"`
+	Remap         RemapMode                                 `json:"remap"`
+
+	// RequestValidationFailurePolicy is the failure policy of the
+	// OperandRequest validating webhook. It defaults to Ignore, so the
+	// OperandRequests aren't blocked while the webhook server is unavailable
+	RequestValidationFailurePolicy admissionregistrationv1.FailurePolicyType `json:"requestValidationFailurePolicy"`
+}
+
+// RemapMode is how the existing OperandRequests are re-mapped when the
+// namespace mapping changes
+type RemapMode string
+
+const (
+	// RemapDisabled leaves the existing OperandRequests as they are
+	RemapDisabled RemapMode = "Disabled"
+
+	// RemapDryRun reports the rewrites in an Event of each OperandRequest,
+	// without patching them
+	RemapDryRun RemapMode = "DryRun"
+
+	// RemapPatch patches the OperandRequests
+	RemapPatch RemapMode = "Patch"
+)
+
+// ConfigMapKey returns the namespaced name of the namespace mapping ConfigMap
+func (c NamespaceMappingConfiguration) ConfigMapKey() types.NamespacedName {
+	return types.NamespacedName{Namespace: c.Namespace, Name: c.Name}
+}
+
+// Default returns the default configuration. The OperandRequest and the
+// namespace mapping webhooks are enabled with ENABLE_OPREQ_WEBHOOK, and the
+// failure policy of the latter is read from NS_MAPPING_FAILURE_POLICY
+func Default() *ManagerConfiguration {
+	return &ManagerConfiguration{
+		APIVersion:      APIVersion,
+		Kind:            Kind,
+		WatchNamespaces: utils.GetWatchNamespaces(),
+		Webhooks: WebhooksConfiguration{
+			PodPreset:         true,
+			OperandRequest:    utils.GetEnableOpreqWebhook(),
+			NamespaceMapping:  utils.GetEnableOpreqWebhook(),
+			MutationPolicy:    false,
+			SwitchesConfigMap: "ibm-common-service-webhook-switches",
+		},
+		Server:                 webhooks.DefaultOptions(),
+		MetricsBindAddress:     "0.0.0.0:8383",
+		HealthProbeBindAddress: ":8081",
+		DefaultCsNamespace:     "ibm-common-services",
+		NamespaceMapping: NamespaceMappingConfiguration{
+			Namespace:     "kube-public",
+			Name:          "common-service-maps",
+			FailurePolicy: admissionregistrationv1.FailurePolicyType(utils.GetNsMappingFailurePolicy()),
+			Remap:         RemapDryRun,
+
+			RequestValidationFailurePolicy: admissionregistrationv1.Ignore,
+		},
+	}
+}
+
+// BindFlags binds the settings to flags of fs. The log level is set with the
+// klog -v flag
+func (c *ManagerConfiguration) BindFlags(fs *flag.FlagSet) {
+	fs.Var((*namespacesValue)(&c.WatchNamespaces), "watch-namespaces", "Comma-separated namespaces watched by the manager, all the namespaces when it's empty")
+	fs.BoolVar(&c.Webhooks.PodPreset, "enable-podpreset-webhook", c.Webhooks.PodPreset, "Enable the pod mutating webhook")
+	fs.BoolVar(&c.Webhooks.OperandRequest, "enable-operandrequest-webhook", c.Webhooks.OperandRequest, "Enable the OperandRequest mutating webhook")
+	fs.BoolVar(&c.Webhooks.NamespaceMapping, "enable-namespace-mapping-webhook", c.Webhooks.NamespaceMapping, "Enable the namespace mapping ConfigMap validating webhook")
+	fs.BoolVar(&c.Webhooks.OperandRequestValidation, "enable-operandrequest-validation-webhook", c.Webhooks.OperandRequestValidation, "Enable the OperandRequest validating webhook")
+	fs.BoolVar(&c.Webhooks.MutationPolicy, "enable-mutationpolicy-webhook", c.Webhooks.MutationPolicy, "Enable the MutationPolicy controller and webhook")
+	fs.StringVar(&c.Webhooks.SwitchesConfigMap, "webhook-switches-configmap", c.Webhooks.SwitchesConfigMap, "Name of the ConfigMap that switches the webhooks at runtime, empty to disable runtime switches")
+	c.Server.BindFlags(fs)
+	fs.StringVar(&c.MetricsBindAddress, "metrics-bind-address", c.MetricsBindAddress, "Address the metrics endpoint binds to, 0 to disable it")
+	fs.StringVar(&c.HealthProbeBindAddress, "health-probe-bind-address", c.HealthProbeBindAddress, "Address the health probes bind to")
+	fs.StringVar(&c.DefaultCsNamespace, "default-cs-namespace", c.DefaultCsNamespace, "Registry namespace of the OperandRequests rewritten by the namespace mapping")
+	fs.StringVar(&c.NamespaceMapping.Namespace, "namespace-mapping-namespace", c.NamespaceMapping.Namespace, "Namespace of the namespace mapping ConfigMap")
+	fs.StringVar(&c.NamespaceMapping.Name, "namespace-mapping-name", c.NamespaceMapping.Name, "Name of the namespace mapping ConfigMap and CommonServiceNamespaceMapping")
+	fs.Var((*failurePolicyValue)(&c.NamespaceMapping.FailurePolicy), "namespace-mapping-failure-policy", "Failure policy of the namespace mapping validating webhook, Ignore or Fail")
+	fs.Var((*failurePolicyValue)(&c.NamespaceMapping.RequestValidationFailurePolicy), "operandrequest-validation-failure-policy", "Failure policy of the OperandRequest validating webhook, Ignore or Fail")
+	fs.StringVar((*string)(&c.NamespaceMapping.Remap), "namespace-mapping-remap", string(c.NamespaceMapping.Remap), "How the existing OperandRequests are re-mapped when the namespace mapping changes, Disabled, DryRun or Patch")
+}
+
+// LoadFile reads the configuration file into c. The settings missing from the
+// file keep their current value, and unknown settings are rejected. The label
+// maps of the file replace the current ones instead of being merged with them
+func (c *ManagerConfiguration) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %v", err)
+	}
+
+	labels, podSelector := c.Server.Labels, c.Server.PodSelector
+	c.Server.Labels, c.Server.PodSelector = nil, nil
+	err = utilyaml.UnmarshalStrict(data, c, utilyaml.DisallowUnknownFields)
+	if c.Server.Labels == nil {
+		c.Server.Labels = labels
+	}
+	if c.Server.PodSelector == nil {
+		c.Server.PodSelector = podSelector
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse configuration file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate returns the errors of the configuration, aggregated in a single one
+func (c *ManagerConfiguration) Validate() error {
+	allErrs := field.ErrorList{}
+
+	if c.APIVersion != APIVersion {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("apiVersion"), c.APIVersion, []string{APIVersion}))
+	}
+	if c.Kind != Kind {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("kind"), c.Kind, []string{Kind}))
+	}
+
+	for i, ns := range c.WatchNamespaces {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("watchNamespaces").Index(i), ns, msg))
+		}
+	}
+
+	if c.Webhooks.SwitchesConfigMap != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(c.Webhooks.SwitchesConfigMap) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("webhooks", "switchesConfigMap"), c.Webhooks.SwitchesConfigMap, msg))
+		}
+	}
+
+	allErrs = append(allErrs, c.Server.Validate(field.NewPath("server"))...)
+
+	if c.MetricsBindAddress != "0" {
+		allErrs = append(allErrs, validateBindAddress(field.NewPath("metricsBindAddress"), c.MetricsBindAddress)...)
+	}
+	allErrs = append(allErrs, validateBindAddress(field.NewPath("healthProbeBindAddress"), c.HealthProbeBindAddress)...)
+
+	for _, msg := range validation.IsDNS1123Label(c.DefaultCsNamespace) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("defaultCsNamespace"), c.DefaultCsNamespace, msg))
+	}
+
+	mappingPath := field.NewPath("namespaceMapping")
+	for _, msg := range validation.IsDNS1123Label(c.NamespaceMapping.Namespace) {
+		allErrs = append(allErrs, field.Invalid(mappingPath.Child("namespace"), c.NamespaceMapping.Namespace, msg))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(c.NamespaceMapping.Name) {
+		allErrs = append(allErrs, field.Invalid(mappingPath.Child("name"), c.NamespaceMapping.Name, msg))
+	}
+	switch c.NamespaceMapping.FailurePolicy {
+	case admissionregistrationv1.Ignore, admissionregistrationv1.Fail:
+	default:
+		allErrs = append(allErrs, field.NotSupported(mappingPath.Child("failurePolicy"), c.NamespaceMapping.FailurePolicy,
+			[]string{string(admissionregistrationv1.Ignore), string(admissionregistrationv1.Fail)}))
+	}
+	switch c.NamespaceMapping.RequestValidationFailurePolicy {
+	case admissionregistrationv1.Ignore, admissionregistrationv1.Fail:
+	default:
+		allErrs = append(allErrs, field.NotSupported(mappingPath.Child("requestValidationFailurePolicy"), c.NamespaceMapping.RequestValidationFailurePolicy,
+			[]string{string(admissionregistrationv1.Ignore), string(admissionregistrationv1.Fail)}))
+	}
+	switch c.NamespaceMapping.Remap {
+	case RemapDisabled, RemapDryRun, RemapPatch:
+	default:
+		allErrs = append(allErrs, field.NotSupported(mappingPath.Child("remap"), c.NamespaceMapping.Remap,
+			[]string{string(RemapDisabled), string(RemapDryRun), string(RemapPatch)}))
+	}
+
+	if c.LogLevel < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("logLevel"), c.LogLevel, "must be greater than or equal to 0"))
+	}
+
+	return allErrs.ToAggregate()
+}
+
+func validateBindAddress(fldPath *field.Path, address string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath, address, err.Error()))
+	}
+	if port == "0" {
+		return allErrs
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, address, err.Error()))
+	}
+	return allErrs
+}
+
+// namespacesValue is a flag.Value of comma-separated namespaces
+type namespacesValue []string
+
+func (v *namespacesValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *namespacesValue) Set(s string) error {
+	*v = utils.SplitNamespaces(s)
+	return nil
+}
+
+// failurePolicyValue is a flag.Value of a failure policy, case insensitive
+type failurePolicyValue admissionregistrationv1.FailurePolicyType
+
+func (v *failurePolicyValue) String() string {
+	return string(*v)
+}
+
+func (v *failurePolicyValue) Set(s string) error {
+	switch {
+	case strings.EqualFold(s, string(admissionregistrationv1.Ignore)):
+		*v = failurePolicyValue(admissionregistrationv1.Ignore)
+	case strings.EqualFold(s, string(admissionregistrationv1.Fail)):
+		*v = failurePolicyValue(admissionregistrationv1.Fail)
+	default:
+		return fmt.Errorf("unsupported failure policy %q, expected Ignore or Fail", s)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileLabels(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		wantLabels      map[string]string
+		wantPodSelector map[string]string
+	}{
+		{
+			name: "labels of the file replace the defaults",
+			content: `apiVersion: webhook.operator.ibm.com/v1alpha1
+kind: ManagerConfiguration
+server:
+  labels:
+    instance: b
+  podSelector:
+    name: webhook-b
+`,
+			wantLabels:      map[string]string{"instance": "b"},
+			wantPodSelector: map[string]string{"name": "webhook-b"},
+		},
+		{
+			name: "labels missing from the file keep the defaults",
+			content: `apiVersion: webhook.operator.ibm.com/v1alpha1
+kind: ManagerConfiguration
+server:
+  port: 9443
+`,
+			wantLabels:      Default().Server.Labels,
+			wantPodSelector: Default().Server.PodSelector,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			if err := c.LoadFile(writeConfig(t, tt.content)); err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(c.Server.Labels, tt.wantLabels) {
+				t.Errorf("Labels = %v, want %v", c.Server.Labels, tt.wantLabels)
+			}
+			if !reflect.DeepEqual(c.Server.PodSelector, tt.wantPodSelector) {
+				t.Errorf("PodSelector = %v, want %v", c.Server.PodSelector, tt.wantPodSelector)
+			}
+		})
+	}
+}
+
+func TestDefaultNsMappingFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    admissionregistrationv1.FailurePolicyType
+		wantErr bool
+	}{
+		{name: "not set", env: "", want: admissionregistrationv1.Fail},
+		{name: "Ignore", env: "Ignore", want: admissionregistrationv1.Ignore},
+		{name: "lower case", env: "ignore", want: admissionregistrationv1.Ignore},
+		{name: "upper case", env: " FAIL ", want: admissionregistrationv1.Fail},
+		{name: "unknown value", env: "Ignroe", want: "Ignroe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NS_MAPPING_FAILURE_POLICY", tt.env)
+			c := Default()
+			if c.NamespaceMapping.FailurePolicy != tt.want {
+				t.Errorf("FailurePolicy = %s, want %s", c.NamespaceMapping.FailurePolicy, tt.want)
+			}
+			err := c.Validate()
+			gotErr := err != nil && strings.Contains(err.Error(), "namespaceMapping.failurePolicy")
+			if gotErr != tt.wantErr {
+				t.Errorf("Validate() error = %v, want an error of namespaceMapping.failurePolicy: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
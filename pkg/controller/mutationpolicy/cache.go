@@ -0,0 +1,61 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mutationpolicy
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+// policyCache runs on every replica, as they all serve the admission requests
+// +k8s:deepcopy-gen=false
+type policyCache struct {
+	cache.Cache
+}
+
+// NeedLeaderElection returns false, so every replica runs the informer
+func (policyCache) NeedLeaderElection() bool {
+	return false
+}
+
+// NewCache returns a cache of the MutationPolicies read by the Mutator, which
+// is started with the manager. The policies are cluster-scoped, so they are
+// cached cluster-wide instead of in the namespaces watched by the manager,
+// whose multi-namespace cache can't get them
+func NewCache(mgr manager.Manager) (client.Reader, error) {
+	c, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The informer is created now, so it's synced when the manager starts
+	// instead of on the first admission request
+	if _, err := c.GetInformer(context.TODO(), &operatorv1alpha1.MutationPolicy{}); err != nil {
+		return nil, err
+	}
+	if err := mgr.Add(policyCache{Cache: c}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,135 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mutationpolicy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+	"github.com/IBM/ibm-common-service-webhook/pkg/audit"
+	"github.com/IBM/ibm-common-service-webhook/pkg/tracing"
+)
+
+// PathPrefix is the path of the webhook server under which every
+// MutationPolicy is served, at PathPrefix + the name of the policy
+const PathPrefix = "/mutate-ibm-cs-policy/"
+
+type policyNameKey struct{}
+
+// WithPolicyName adds the name of the MutationPolicy in the path of the
+// request into the context. It's set as the WithContextFunc of the webhook
+func WithPolicyName(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, policyNameKey{}, strings.TrimPrefix(r.URL.Path, PathPrefix))
+}
+
+// Mutator applies the patches of the MutationPolicy named in the path of the
+// request. A single Mutator serves every policy, so they are added and
+// removed at runtime
+// +k8s:deepcopy-gen=false
+type Mutator struct {
+	// Reader gets the MutationPolicies from the cache returned by NewCache
+	Reader client.Reader
+
+	// Scheme has the strategic merge metadata of the built-in kinds
+	Scheme *runtime.Scheme
+}
+
+// Handle mutates the objects matching the policy
+func (p *Mutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := logf.FromContext(ctx)
+
+	name, _ := ctx.Value(policyNameKey{}).(string)
+	if name == "" {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("the path does not name a MutationPolicy"))
+	}
+	logger = logger.WithValues("MutationPolicy", name)
+
+	policy := &operatorv1alpha1.MutationPolicy{}
+	getCtx, span := tracing.StartSpan(ctx, "get-mutation-policy")
+	err := p.Reader.Get(getCtx, types.NamespacedName{Name: name}, policy)
+	tracing.EndSpan(span, client.IgnoreNotFound(err))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// The webhook configuration is garbage collected after the policy
+			logger.V(1).Info("MutationPolicy is not found")
+			return admission.Allowed("")
+		}
+		logger.Error(err, "Error occurred getting MutationPolicy")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	target := policy.Spec.Target
+	if len(req.Object.Raw) == 0 || req.Kind.Group != target.Group || req.Kind.Version != target.Version || req.Kind.Kind != target.Kind {
+		logger.V(1).Info("Object is not the target of the MutationPolicy")
+		return admission.Allowed("")
+	}
+
+	_, span = tracing.StartSpan(ctx, "apply-patches")
+	mutated, err := p.applyPatches(req.Object.Raw, schema.GroupVersionKind(req.Kind), policy.Spec.Patches)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		logger.Error(err, "Error occurred applying MutationPolicy")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	audit.AddReason(ctx, fmt.Sprintf("mutationpolicy %s", name))
+
+	// admission.PatchResponse generates a Response containing patches.
+	return admission.PatchResponseFromRaw(req.Object.Raw, mutated)
+}
+
+// applyPatches applies the patches in order to the object. Strategic merge
+// fragments are applied as JSON merge patches to the kinds missing from the
+// scheme, e.g. custom resources
+func (p *Mutator) applyPatches(object []byte, gvk schema.GroupVersionKind, patches []operatorv1alpha1.MutationPatch) ([]byte, error) {
+	var err error
+	for i, patch := range patches {
+		switch patch.Type {
+		case operatorv1alpha1.JSONPatchType:
+			var jsonPatch jsonpatch.Patch
+			jsonPatch, err = jsonpatch.DecodePatch(patch.Patch.Raw)
+			if err == nil {
+				object, err = jsonPatch.Apply(object)
+			}
+		case operatorv1alpha1.StrategicMergePatchType:
+			if dataStruct, newErr := p.Scheme.New(gvk); newErr == nil {
+				object, err = strategicpatch.StrategicMergePatch(object, patch.Patch.Raw, dataStruct)
+			} else {
+				object, err = jsonpatch.MergePatch(object, patch.Patch.Raw)
+			}
+		default:
+			err = fmt.Errorf("unsupported type %q", patch.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply patch %d: %v", i, err)
+		}
+	}
+	return object, nil
+}
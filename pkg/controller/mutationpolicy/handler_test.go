@@ -0,0 +1,230 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mutationpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+var (
+	deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	customGVK     = schema.GroupVersionKind{Group: "operator.ibm.com", Version: "v1alpha1", Kind: "Custom"}
+)
+
+const deployment = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"app"},"spec":{"template":{"spec":{"containers":[{"name":"app","image":"app:1"},{"name":"sidecar","image":"sidecar:1"}]}}}}`
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := operatorv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func patch(patchType operatorv1alpha1.MutationPatchType, raw string) operatorv1alpha1.MutationPatch {
+	return operatorv1alpha1.MutationPatch{Type: patchType, Patch: runtime.RawExtension{Raw: []byte(raw)}}
+}
+
+func TestApplyPatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		gvk     schema.GroupVersionKind
+		object  string
+		patches []operatorv1alpha1.MutationPatch
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "JSON patch",
+			gvk:     deploymentGVK,
+			object:  `{"spec":{"replicas":1}}`,
+			patches: []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.JSONPatchType, `[{"op":"replace","path":"/spec/replicas","value":3}]`)},
+			want:    `{"spec":{"replicas":3}}`,
+		},
+		{
+			name:    "strategic merge merges the lists by their merge key",
+			gvk:     deploymentGVK,
+			object:  deployment,
+			patches: []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.StrategicMergePatchType, `{"spec":{"template":{"spec":{"containers":[{"name":"sidecar","image":"sidecar:2"}]}}}}`)},
+			want:    `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"app"},"spec":{"template":{"spec":{"containers":[{"name":"app","image":"app:1"},{"name":"sidecar","image":"sidecar:2"}]}}}}`,
+		},
+		{
+			name:    "merge patch replaces the lists of the kinds missing from the scheme",
+			gvk:     customGVK,
+			object:  `{"spec":{"items":[{"name":"a"},{"name":"b"}],"size":1}}`,
+			patches: []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.StrategicMergePatchType, `{"spec":{"items":[{"name":"c"}]}}`)},
+			want:    `{"spec":{"items":[{"name":"c"}],"size":1}}`,
+		},
+		{
+			name:   "patches applied in order",
+			gvk:    customGVK,
+			object: `{"spec":{"size":1}}`,
+			patches: []operatorv1alpha1.MutationPatch{
+				patch(operatorv1alpha1.StrategicMergePatchType, `{"spec":{"size":2}}`),
+				patch(operatorv1alpha1.JSONPatchType, `[{"op":"test","path":"/spec/size","value":2},{"op":"add","path":"/spec/name","value":"x"}]`),
+			},
+			want: `{"spec":{"name":"x","size":2}}`,
+		},
+		{
+			name:    "JSON patch failing",
+			gvk:     deploymentGVK,
+			object:  `{"spec":{"replicas":1}}`,
+			patches: []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.JSONPatchType, `[{"op":"test","path":"/spec/replicas","value":2}]`)},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported type",
+			gvk:     deploymentGVK,
+			object:  `{"spec":{}}`,
+			patches: []operatorv1alpha1.MutationPatch{patch("MergePatch", `{"spec":{"replicas":3}}`)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Mutator{Scheme: newScheme(t)}
+			got, err := p.applyPatches([]byte(tt.object), tt.gvk, tt.patches)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyPatches() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var gotObject, wantObject interface{}
+			if err := json.Unmarshal(got, &gotObject); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantObject); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotObject, wantObject) {
+				t.Errorf("applyPatches() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMutatorHandle(t *testing.T) {
+	scheme := newScheme(t)
+	policy := &operatorv1alpha1.MutationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "replicas"},
+		Spec: operatorv1alpha1.MutationPolicySpec{
+			Target:  operatorv1alpha1.MutationTarget{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Patches: []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.JSONPatchType, `[{"op":"add","path":"/spec/replicas","value":3}]`)},
+		},
+	}
+	failing := policy.DeepCopy()
+	failing.Name = "failing"
+	failing.Spec.Patches = []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.JSONPatchType, `[{"op":"test","path":"/kind","value":"StatefulSet"}]`)}
+
+	p := &Mutator{
+		Reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(policy, failing).Build(),
+		Scheme: scheme,
+	}
+
+	tests := []struct {
+		name        string
+		policyName  string
+		kind        metav1.GroupVersionKind
+		object      string
+		wantAllowed bool
+		wantCode    int32
+		wantPatches int
+	}{
+		{
+			name:        "target is patched",
+			policyName:  "replicas",
+			kind:        metav1.GroupVersionKind(deploymentGVK),
+			object:      deployment,
+			wantAllowed: true,
+			wantPatches: 1,
+		},
+		{
+			name:        "other kind is allowed as is",
+			policyName:  "replicas",
+			kind:        metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+			object:      `{"spec":{}}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "other version is allowed as is",
+			policyName:  "replicas",
+			kind:        metav1.GroupVersionKind{Group: "apps", Version: "v1beta1", Kind: "Deployment"},
+			object:      `{"spec":{}}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "missing policy is allowed as is",
+			policyName:  "deleted",
+			kind:        metav1.GroupVersionKind(deploymentGVK),
+			object:      deployment,
+			wantAllowed: true,
+		},
+		{
+			name:     "path without policy",
+			kind:     metav1.GroupVersionKind(deploymentGVK),
+			object:   deployment,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "failing patch",
+			policyName: "failing",
+			kind:       metav1.GroupVersionKind(deploymentGVK),
+			object:     deployment,
+			wantCode:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), policyNameKey{}, tt.policyName)
+			resp := p.Handle(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Kind:      tt.kind,
+				Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+			}})
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("Handle() allowed = %v, want %v: %v", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+			if tt.wantCode != 0 && (resp.Result == nil || resp.Result.Code != tt.wantCode) {
+				t.Errorf("Handle() result = %v, want code %d", resp.Result, tt.wantCode)
+			}
+			if len(resp.Patches) != tt.wantPatches {
+				t.Errorf("Handle() patches = %v, want %d", resp.Patches, tt.wantPatches)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mutationpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+	"github.com/IBM/ibm-common-service-webhook/pkg/webhooks"
+)
+
+const (
+	configurationPrefix = "ibm-cs-mutation-policy"
+	webhookNameSuffix   = "mutationpolicy.operator.ibm.com"
+
+	// namespaceNameLabel is set by the API server to the name of each
+	// namespace, from Kubernetes 1.21
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+
+	// ReadyCondition is true once the webhook configuration of the policy is
+	// reconciled
+	ReadyCondition = "Ready"
+)
+
+// ReconcileMutationPolicy reconciles the MutatingWebhookConfiguration of each
+// MutationPolicy, pointing to the generic Mutator
+type ReconcileMutationPolicy struct {
+	Client client.Client
+	Scheme *runtime.Scheme
+
+	// RESTMapper resolves the resource of the target kind of the policies
+	RESTMapper meta.RESTMapper
+
+	// WebhookConfig is the configuration of the webhook server
+	WebhookConfig *webhooks.CSWebhookConfig
+}
+
+// Reconcile applies the webhook configuration of a MutationPolicy and reports
+// the result in its Ready condition. The webhook configuration is owned by the
+// policy, so it's garbage collected once the policy is deleted
+func (r *ReconcileMutationPolicy) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	logger := logf.FromContext(ctx)
+	logger.Info("Reconciling MutationPolicy")
+
+	policy := &operatorv1alpha1.MutationPolicy{}
+	if err := r.Client.Get(ctx, request.NamespacedName, policy); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	reconcileErr := r.reconcileWebhook(ctx, policy)
+
+	condition := metav1.Condition{
+		Type:               ReadyCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Reconciled",
+		Message:            "The webhook configuration is reconciled",
+		ObservedGeneration: policy.Generation,
+	}
+	if reconcileErr != nil {
+		logger.Error(reconcileErr, "Failed to reconcile MutationPolicy")
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ReconcileFailed"
+		condition.Message = reconcileErr.Error()
+	}
+	meta.SetStatusCondition(&policy.Status.Conditions, condition)
+	policy.Status.ObservedGeneration = policy.Generation
+	if err := r.Client.Status().Update(ctx, policy); err != nil {
+		if errors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, reconcileErr
+}
+
+func (r *ReconcileMutationPolicy) reconcileWebhook(ctx context.Context, policy *operatorv1alpha1.MutationPolicy) error {
+	if err := validatePatches(policy.Spec.Patches); err != nil {
+		return err
+	}
+
+	target := policy.Spec.Target
+	mapping, err := r.RESTMapper.RESTMapping(schema.GroupKind{Group: target.Group, Kind: target.Kind}, target.Version)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the target %s: %v", schema.GroupVersionKind(target), err)
+	}
+
+	operations := policy.Spec.Operations
+	if len(operations) == 0 {
+		operations = []admissionregistrationv1.OperationType{admissionregistrationv1.Create}
+	}
+	rule := webhooks.NewRule().
+		OneResource(target.Group, target.Version, mapping.Resource.Resource).
+		ForOperations(operations...)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		rule = rule.NamespacedScope()
+	} else {
+		rule = rule.ClusterScope()
+	}
+
+	var nsSelector, objectSelector metav1.LabelSelector
+	if policy.Spec.NamespaceSelector != nil {
+		nsSelector = *policy.Spec.NamespaceSelector.DeepCopy()
+	}
+	if policy.Spec.ObjectSelector != nil {
+		objectSelector = *policy.Spec.ObjectSelector.DeepCopy()
+	}
+	// The namespace and the pods of the operator are always excluded, so a
+	// policy failing its requests can't block the webhook server it's served
+	// by. The name label of the namespaces is set from Kubernetes 1.21, as
+	// checked by CheckServerVersion
+	nsSelector.MatchExpressions = append(nsSelector.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      namespaceNameLabel,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{r.WebhookConfig.Namespace},
+	})
+	objectSelector.MatchExpressions = append(objectSelector.MatchExpressions, r.WebhookConfig.OwnPodsExclusion()...)
+
+	labels := map[string]string{webhooks.DynamicWebhookLabel: "true"}
+	for key, value := range r.WebhookConfig.Labels {
+		labels[key] = value
+	}
+
+	gvk := operatorv1alpha1.SchemeGroupVersion.WithKind("MutationPolicy")
+	ownerReference := metav1.NewControllerRef(policy, gvk)
+
+	caBundle, err := r.WebhookConfig.CABundle(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+
+	reconciler := &webhooks.MutatingWebhookReconciler{
+		Path: PathPrefix + policy.Name,
+	}
+	reconciler.SetName(r.WebhookConfig.ConfigurationName(fmt.Sprintf("%s-%s", configurationPrefix, policy.Name)))
+	reconciler.SetWebhookName(fmt.Sprintf("%s.%s", policy.Name, webhookNameSuffix))
+	reconciler.SetRules([]webhooks.RuleWithOperations{rule})
+	reconciler.SetNsSelector(nsSelector)
+	reconciler.SetObjectSelector(objectSelector)
+	reconciler.SetFailurePolicy(policy.Spec.FailurePolicy)
+	reconciler.SetService(r.WebhookConfig.Namespace, r.WebhookConfig.ServiceName, int32(r.WebhookConfig.ServicePort))
+	reconciler.SetLabels(labels)
+	reconciler.SetOwnerReferences([]metav1.OwnerReference{*ownerReference})
+	return reconciler.Reconcile(ctx, r.Client, caBundle)
+}
+
+// validatePatches checks that the patches can be decoded, so a policy with an
+// invalid patch isn't served
+func validatePatches(patches []operatorv1alpha1.MutationPatch) error {
+	if len(patches) == 0 {
+		return fmt.Errorf("the policy has no patches")
+	}
+	for i, patch := range patches {
+		switch patch.Type {
+		case operatorv1alpha1.JSONPatchType:
+			if _, err := jsonpatch.DecodePatch(patch.Patch.Raw); err != nil {
+				return fmt.Errorf("patch %d is not a valid JSON patch: %v", i, err)
+			}
+		case operatorv1alpha1.StrategicMergePatchType:
+			fragment := map[string]interface{}{}
+			if err := json.Unmarshal(patch.Patch.Raw, &fragment); err != nil {
+				return fmt.Errorf("patch %d is not a valid strategic merge fragment: %v", i, err)
+			}
+		default:
+			return fmt.Errorf("patch %d has an unsupported type %q", i, patch.Type)
+		}
+	}
+	return nil
+}
+
+// minServerVersion is the first version of Kubernetes that sets the name
+// label of the namespaces, which excludes the operator namespace from the
+// policies
+var minServerVersion = version.MustParseGeneric("1.21.0")
+
+// CheckServerVersion returns an error when the cluster is older than
+// Kubernetes 1.21, where the namespace selectors of the policies can't exclude
+// the operator namespace
+func CheckServerVersion(config *rest.Config) error {
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	info, err := client.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get the server version: %v", err)
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse the server version %s: %v", info.GitVersion, err)
+	}
+	if serverVersion.LessThan(minServerVersion) {
+		return fmt.Errorf("MutationPolicies require Kubernetes %s or later, the server version is %s", minServerVersion, serverVersion)
+	}
+	return nil
+}
+
+func (r *ReconcileMutationPolicy) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&operatorv1alpha1.MutationPolicy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
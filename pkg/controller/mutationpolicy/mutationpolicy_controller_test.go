@@ -0,0 +1,98 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mutationpolicy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	k8sversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/rest"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+func TestValidatePatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		patches []operatorv1alpha1.MutationPatch
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			patches: []operatorv1alpha1.MutationPatch{
+				patch(operatorv1alpha1.JSONPatchType, `[{"op":"add","path":"/spec/replicas","value":3}]`),
+				patch(operatorv1alpha1.StrategicMergePatchType, `{"spec":{"paused":true}}`),
+			},
+		},
+		{
+			name:    "no patches",
+			wantErr: true,
+		},
+		{
+			name:    "JSON patch that isn't a list of operations",
+			patches: []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.JSONPatchType, `{"op":"add"}`)},
+			wantErr: true,
+		},
+		{
+			name:    "strategic merge fragment that isn't an object",
+			patches: []operatorv1alpha1.MutationPatch{patch(operatorv1alpha1.StrategicMergePatchType, `["spec"]`)},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported type",
+			patches: []operatorv1alpha1.MutationPatch{patch("MergePatch", `{"spec":{}}`)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePatches(tt.patches); (err != nil) != tt.wantErr {
+				t.Errorf("validatePatches() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		gitVersion string
+		wantErr    bool
+	}{
+		{name: "1.21", gitVersion: "v1.21.0"},
+		{name: "OpenShift build", gitVersion: "v1.23.5+3afdacb"},
+		{name: "1.20", gitVersion: "v1.20.15", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(k8sversion.Info{GitVersion: tt.gitVersion})
+			}))
+			defer server.Close()
+
+			if err := CheckServerVersion(&rest.Config{Host: server.URL}); (err != nil) != tt.wantErr {
+				t.Errorf("CheckServerVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
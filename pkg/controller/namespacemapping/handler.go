@@ -0,0 +1,126 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package namespacemapping
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+	"github.com/IBM/ibm-common-service-webhook/pkg/nsmapping"
+)
+
+// Validator validates the CommonServiceNamespaceMappings. The syntax of the
+// namespaces is validated by the CRD schema, and the rules across mappings
+// by nsmapping.Validate
+// +k8s:deepcopy-gen=false
+type Validator struct {
+	Reader client.Reader
+
+	// Name of the CommonServiceNamespaceMapping that is used, the others are
+	// allowed with a warning
+	Name string
+
+	// DefaultCsNs is the default Common Services namespace, when the mapping
+	// doesn't set its own defaultCsNamespace
+	DefaultCsNs string
+
+	// RemapsRequests is true when the OperandRequests are patched when the
+	// mapping changes, so the namespaces referenced by OperandRequests can be
+	// moved
+	RemapsRequests bool
+
+	decoder *admission.Decoder
+}
+
+// Handle validates the created, updated and deleted
+// CommonServiceNamespaceMappings
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := logf.FromContext(ctx)
+
+	if req.Operation == admissionv1.Delete {
+		oldMapping := &operatorv1alpha1.CommonServiceNamespaceMapping{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldMapping); err != nil {
+			logger.Error(err, "Error occurred decoding old CommonServiceNamespaceMapping")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if oldMapping.Name == v.Name && !nsmapping.AllowsRemapping(oldMapping.Annotations) {
+			return admission.Denied(fmt.Sprintf("the CommonServiceNamespaceMapping cannot be deleted without the %s annotation", nsmapping.AllowRemappingAnnotation))
+		}
+		return admission.Allowed("")
+	}
+
+	mapping := &operatorv1alpha1.CommonServiceNamespaceMapping{}
+	if err := v.decoder.Decode(req, mapping); err != nil {
+		logger.Error(err, "Error occurred decoding CommonServiceNamespaceMapping")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	spec := mapping.Spec.DeepCopy()
+	if spec.DefaultCsNamespace == "" {
+		spec.DefaultCsNamespace = v.DefaultCsNs
+	}
+
+	fldPath := field.NewPath("spec")
+	allErrs := nsmapping.Validate(spec, fldPath)
+
+	// The other mappings aren't used, so only their structure is validated
+	if mapping.Name != v.Name {
+		if len(allErrs) > 0 {
+			return admission.Denied(allErrs.ToAggregate().Error())
+		}
+		return admission.Allowed("").WithWarnings(fmt.Sprintf("only the CommonServiceNamespaceMapping named %s is used", v.Name))
+	}
+
+	if req.Operation == admissionv1.Update {
+		oldMapping := &operatorv1alpha1.CommonServiceNamespaceMapping{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldMapping); err != nil {
+			logger.Error(err, "Error occurred decoding old CommonServiceNamespaceMapping")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !nsmapping.AllowsRemapping(mapping.Annotations) {
+			allErrs = append(allErrs, nsmapping.ValidateTransition(&oldMapping.Spec, spec, fldPath)...)
+		}
+		if !v.RemapsRequests {
+			allErrs = append(allErrs, nsmapping.ValidateMoves(ctx, v.Reader, &oldMapping.Spec, spec, fldPath)...)
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return admission.Denied(allErrs.ToAggregate().Error())
+	}
+
+	// The mapping is allowed even if it can't be cross-checked
+	warnings, err := nsmapping.Warnings(ctx, v.Reader, spec)
+	if err != nil {
+		logger.Error(err, "Failed to cross-check the namespace mapping with the cluster")
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// InjectDecoder injects the decoder into the Validator
+func (v *Validator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,101 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package namespacemapping
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+	"github.com/IBM/ibm-common-service-webhook/pkg/nsmapping"
+)
+
+// ValidCondition is true when the mapping passes the validation of the
+// webhook, which may have been disabled when it was applied
+const ValidCondition = "Valid"
+
+// ReconcileNamespaceMapping reports the validity of the
+// CommonServiceNamespaceMappings in their status
+type ReconcileNamespaceMapping struct {
+	Client client.Client
+
+	// Name of the CommonServiceNamespaceMapping that is used
+	Name string
+
+	// DefaultCsNs is the default Common Services namespace, when the mapping
+	// doesn't set its own defaultCsNamespace
+	DefaultCsNs string
+}
+
+// Reconcile validates a CommonServiceNamespaceMapping and sets its Valid
+// condition
+func (r *ReconcileNamespaceMapping) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	logger := logf.FromContext(ctx)
+	logger.Info("Reconciling CommonServiceNamespaceMapping")
+
+	mapping := &operatorv1alpha1.CommonServiceNamespaceMapping{}
+	if err := r.Client.Get(ctx, request.NamespacedName, mapping); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	condition := metav1.Condition{
+		Type:               ValidCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Valid",
+		Message:            "The namespace mapping is valid",
+		ObservedGeneration: mapping.Generation,
+	}
+	spec := mapping.Spec.DeepCopy()
+	if spec.DefaultCsNamespace == "" {
+		spec.DefaultCsNamespace = r.DefaultCsNs
+	}
+	if errs := nsmapping.Validate(spec, field.NewPath("spec")); len(errs) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Invalid"
+		condition.Message = errs.ToAggregate().Error()
+	} else if mapping.Name != r.Name {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Unused"
+		condition.Message = fmt.Sprintf("Only the CommonServiceNamespaceMapping named %s is used", r.Name)
+	}
+	meta.SetStatusCondition(&mapping.Status.Conditions, condition)
+	mapping.Status.ObservedGeneration = mapping.Generation
+	if err := r.Client.Status().Update(ctx, mapping); err != nil {
+		if errors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *ReconcileNamespaceMapping) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&operatorv1alpha1.CommonServiceNamespaceMapping{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -21,77 +21,105 @@ import (
 	"fmt"
 	"net/http"
 
-	utilyaml "github.com/ghodss/yaml"
+	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/klog"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/nsmapping"
 )
 
 // Mutator is the struct of webhook
 // +k8s:deepcopy-gen=false
 type Mutator struct {
-	Reader  client.Reader
-	decoder *admission.Decoder
-}
+	Reader client.Reader
 
-type csMaps struct {
-	ControlNs     string      `json:"controlNamespace"`
-	NsMappingList []nsMapping `json:"namespaceMapping"`
-}
+	// MappingConfigMap is the namespace mapping ConfigMap, other ConfigMaps
+	// are allowed
+	MappingConfigMap types.NamespacedName
+
+	// DefaultCsNs is the default Common Services namespace, when the mapping
+	// doesn't set its own defaultCsNs
+	DefaultCsNs string
+
+	// RemapsRequests is true when the OperandRequests are patched when the
+	// mapping changes, so the namespaces referenced by OperandRequests can be
+	// moved
+	RemapsRequests bool
 
-type nsMapping struct {
-	RequestNS []string `json:"requested-from-namespace"`
-	CsNs      string   `json:"map-to-common-service-namespace"`
+	decoder *admission.Decoder
 }
 
 // Handle mutates every creating pods
 func (p *Mutator) Handle(ctx context.Context, req admission.Request) admission.Response {
 
-	if req.Name != "common-service-maps" || req.Namespace != "kube-public" {
+	if req.Name != p.MappingConfigMap.Name || req.Namespace != p.MappingConfigMap.Namespace {
+		return admission.Allowed("")
+	}
+
+	logger := logf.FromContext(ctx)
+	logger.V(1).Info("Validating common service namespace mapping")
+
+	if req.Operation == admissionv1.Delete {
+		oldCm := &corev1.ConfigMap{}
+		if err := p.decoder.DecodeRaw(req.OldObject, oldCm); err != nil {
+			logger.Error(err, "Error occurred decoding old ConfigMap")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !nsmapping.AllowsRemapping(oldCm.Annotations) {
+			return admission.Denied(fmt.Sprintf("the namespace mapping ConfigMap cannot be deleted without the %s annotation", nsmapping.AllowRemappingAnnotation))
+		}
 		return admission.Allowed("")
 	}
 
-	klog.Infof("Webhook is invoked by Configmap %s/%s", req.AdmissionRequest.Namespace, req.AdmissionRequest.Name)
 	cm := &corev1.ConfigMap{}
 	err := p.decoder.Decode(req, cm)
 	if err != nil {
-		klog.Error(err, "Error occurred decoding OperandRequest")
+		logger.Error(err, "Error occurred decoding ConfigMap")
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	commonServiceMaps := cm.Data["common-service-maps.yaml"]
-	var cmData csMaps
-	if err := utilyaml.Unmarshal([]byte(commonServiceMaps), &cmData); err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+	spec, err := nsmapping.ParseConfigMapStrict(cm)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	if spec.DefaultCsNamespace == "" {
+		spec.DefaultCsNamespace = p.DefaultCsNs
 	}
 
-	CsNsSet := make(map[string]interface{})
-	RequestNsSet := make(map[string]interface{})
+	fldPath := field.NewPath("data").Key(nsmapping.ConfigMapKey)
+	allErrs := nsmapping.Validate(spec, fldPath)
 
-	for _, nsMapping := range cmData.NsMappingList {
-		// validate masterNamespace and controlNamespace
-		if cmData.ControlNs == nsMapping.CsNs {
-			return admission.Denied(fmt.Sprintf("controlNamespace: %v cannot be the same as one of the map-to-common-service-namespace", cmData.ControlNs))
+	if req.Operation == admissionv1.Update {
+		oldCm := &corev1.ConfigMap{}
+		if err := p.decoder.DecodeRaw(req.OldObject, oldCm); err != nil {
+			logger.Error(err, "Error occurred decoding old ConfigMap")
+			return admission.Errored(http.StatusBadRequest, err)
 		}
-		if _, ok := CsNsSet[nsMapping.CsNs]; ok {
-			return admission.Denied(fmt.Sprintf("map-to-common-service-namespace: %v exists in other namespace mappings", nsMapping.CsNs))
-		}
-		CsNsSet[nsMapping.CsNs] = struct{}{}
-		// validate CloudPak Namespace and controlNamespace
-		for _, ns := range nsMapping.RequestNS {
-			if cmData.ControlNs == ns {
-				return admission.Denied(fmt.Sprintf("controlNamespace: %v cannot be the same as one of the requested-from-namespace", cmData.ControlNs))
+		// The old mapping may not have been validated
+		if oldSpec, err := nsmapping.ParseConfigMap(oldCm); err == nil {
+			if !nsmapping.AllowsRemapping(cm.Annotations) {
+				allErrs = append(allErrs, nsmapping.ValidateTransition(oldSpec, spec, fldPath)...)
 			}
-			if _, ok := RequestNsSet[ns]; ok {
-				return admission.Denied(fmt.Sprintf("There are multiple %v exit in the requested-from-namespace", ns))
+			if !p.RemapsRequests {
+				allErrs = append(allErrs, nsmapping.ValidateMoves(ctx, p.Reader, oldSpec, spec, fldPath)...)
 			}
-			RequestNsSet[ns] = struct{}{}
 		}
 	}
 
-	// admission.PatchResponse generates a Response containing patches.
-	return admission.Allowed("")
+	if len(allErrs) > 0 {
+		return admission.Denied(allErrs.ToAggregate().Error())
+	}
+
+	// The mapping is allowed even if it can't be cross-checked
+	warnings, err := nsmapping.Warnings(ctx, p.Reader, spec)
+	if err != nil {
+		logger.Error(err, "Failed to cross-check the namespace mapping with the cluster")
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
 
 }
 
@@ -22,43 +22,48 @@ import (
 	"fmt"
 	"net/http"
 
-	utilyaml "github.com/ghodss/yaml"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/audit"
+	"github.com/IBM/ibm-common-service-webhook/pkg/metrics"
+	"github.com/IBM/ibm-common-service-webhook/pkg/nsmapping"
+	"github.com/IBM/ibm-common-service-webhook/pkg/tracing"
 )
 
 // Mutator is the struct of webhook
 // +k8s:deepcopy-gen=false
 type Mutator struct {
-	Reader  client.Reader
-	decoder *admission.Decoder
-}
+	// Reader gets the labels of the namespace, when a mapping selects the
+	// namespaces by their labels
+	Reader client.Reader
 
-type csMaps struct {
-	NsMappingList []nsMapping `json:"namespaceMapping"`
-	DefaultCsNs   string      `json:"defaultCsNs"`
-}
+	// Mappings is the cache of the namespace mapping
+	Mappings *nsmapping.Cache
+
+	// DefaultCsNs is the registry namespace rewritten when the mapping doesn't
+	// set its own defaultCsNs
+	DefaultCsNs string
 
-type nsMapping struct {
-	RequestNS []string `json:"requested-from-namespace"`
-	CsNs      string   `json:"map-to-common-service-namespace"`
+	decoder *admission.Decoder
 }
 
 // Handle mutates every creating pods
 func (p *Mutator) Handle(ctx context.Context, req admission.Request) admission.Response {
 
-	klog.Infof("Webhook is invoked by OperandRequest %s/%s", req.AdmissionRequest.Namespace, req.AdmissionRequest.Name)
+	logger := logf.FromContext(ctx)
 	opreq := &odlmv1alpha1.OperandRequest{}
 	ns := req.AdmissionRequest.Namespace
+	_, span := tracing.StartSpan(ctx, "decode")
 	err := p.decoder.Decode(req, opreq)
+	tracing.EndSpan(span, err)
 	if err != nil {
-		klog.Error(err, "Error occurred decoding OperandRequest")
+		logger.Error(err, "Error occurred decoding OperandRequest")
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 	copy := opreq.DeepCopy()
@@ -66,9 +71,11 @@ func (p *Mutator) Handle(ctx context.Context, req admission.Request) admission.R
 	err = p.mutatePodsFn(ctx, copy, ns)
 
 	if err != nil {
-		klog.Error(err, "Error occurred mutating OperandRequest")
+		logger.Error(err, "Error occurred mutating OperandRequest")
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
+	_, span = tracing.StartSpan(ctx, "generate-patch")
+	defer span.End()
 	marshaledOpreq, err := json.Marshal(opreq)
 	marshaledcopy, err := json.Marshal(copy)
 
@@ -80,53 +87,51 @@ func (p *Mutator) Handle(ctx context.Context, req admission.Request) admission.R
 // Mutates function values
 func (p *Mutator) mutatePodsFn(ctx context.Context, opreq *odlmv1alpha1.OperandRequest, namespace string) error {
 
-	csConfigmap := &corev1.ConfigMap{}
-
-	err := p.Reader.Get(ctx, types.NamespacedName{Namespace: "kube-public", Name: "common-service-maps"}, csConfigmap)
-
+	mapping, err := p.Mappings.Get()
 	if err != nil {
-		if errors.IsNotFound(err) {
-			klog.Infof("common service configmap kube-public/common-service-maps is not found: %v", err)
-			return nil
-		}
-		return fmt.Errorf("failed to fetch configmap kube-public/common-service-maps: %v", err)
-	}
-
-	commonServiceMaps := csConfigmap.Data["common-service-maps.yaml"]
-	var cmData csMaps
-	if err := utilyaml.Unmarshal([]byte(commonServiceMaps), &cmData); err != nil {
 		return err
 	}
+	if mapping == nil {
+		logf.FromContext(ctx).V(1).Info("common service namespace mapping is not found")
+		return nil
+	}
+	spec := mapping.Spec
 
 	var defaultCsNs string
-	if cmData.DefaultCsNs == "" {
-		defaultCsNs = "ibm-common-services"
+	if spec.DefaultCsNamespace == "" {
+		defaultCsNs = p.DefaultCsNs
 	} else {
-		defaultCsNs = cmData.DefaultCsNs
+		defaultCsNs = spec.DefaultCsNamespace
 	}
 
-	for _, nsMapping := range cmData.NsMappingList {
-		if findNamespace(append(nsMapping.RequestNS, nsMapping.CsNs), opreq.Namespace) {
-			for index, req := range opreq.Spec.Requests {
-				if req.RegistryNamespace == defaultCsNs {
-					req.RegistryNamespace = nsMapping.CsNs
-					opreq.Spec.Requests[index] = req
-				}
-			}
-			break
+	var nsLabels map[string]string
+	if nsmapping.HasSelectors(spec) {
+		ns := &corev1.Namespace{}
+		if err := p.Reader.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			return fmt.Errorf("failed to get namespace %s: %v", namespace, err)
+		}
+		nsLabels = ns.Labels
+		if nsLabels == nil {
+			nsLabels = map[string]string{}
 		}
 	}
 
-	return nil
-}
-
-func findNamespace(nsList []string, nsName string) (exist bool) {
-	for _, ns := range nsList {
-		if ns == nsName {
-			return true
-		}
+	nsMapping, ok := nsmapping.Find(spec, namespace, nsLabels)
+	if !ok {
+		return nil
 	}
-	return
+	rewritten, err := nsmapping.RewriteRequests(opreq, nsMapping, defaultCsNs)
+	if err != nil {
+		return err
+	}
+	for _, r := range rewritten {
+		req := opreq.Spec.Requests[r.Index]
+		metrics.OperandRequestRewrites.WithLabelValues(nsMapping.MapToCommonServiceNamespace).Inc()
+		audit.AddReason(ctx, fmt.Sprintf("namespace mapping %s: registry %s from %s to %s", mapping.Source, r.Original.Registry, defaultCsNs, nsMapping.MapToCommonServiceNamespace))
+		logf.FromContext(ctx).V(1).Info("Rewrote registryNamespace", "registry", req.Registry, "registryNamespace", req.RegistryNamespace)
+	}
+
+	return nil
 }
 
 // InjectDecoder injects the decoder into the Mutator
@@ -0,0 +1,170 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package operandrequest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+	"github.com/IBM/ibm-common-service-webhook/pkg/metrics"
+	"github.com/IBM/ibm-common-service-webhook/pkg/nsmapping"
+)
+
+// ReconcileOperandRequest re-maps the existing OperandRequests when the
+// namespace mapping changes, as the Mutator only rewrites the OperandRequests
+// when they are created or updated. Along with the requests to the default
+// Common Services namespace, the requests to a Common Services namespace the
+// namespace was mapped to before are rewritten, so the moved and removed
+// namespaces converge to their current Common Services namespace
+type ReconcileOperandRequest struct {
+	Client client.Client
+
+	// Reader lists the OperandRequests and the namespaces
+	Reader client.Reader
+
+	Recorder record.EventRecorder
+
+	// Mappings is the cache of the namespace mapping
+	Mappings *nsmapping.Cache
+
+	// DefaultCsNs is the registry namespace rewritten when the mapping doesn't
+	// set its own defaultCsNs
+	DefaultCsNs string
+
+	// DryRun reports the rewrites in an Event of each OperandRequest instead
+	// of patching it
+	DryRun bool
+}
+
+// Reconcile re-maps every OperandRequest, except the ones of the control
+// namespace, which can request operands from any namespace
+func (r *ReconcileOperandRequest) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	logger := logf.FromContext(ctx)
+	logger.Info("Re-mapping OperandRequests", "dryRun", r.DryRun)
+
+	mapping, err := r.Mappings.Get()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if mapping == nil {
+		logger.V(1).Info("common service namespace mapping is not found")
+		return ctrl.Result{}, nil
+	}
+	spec := mapping.Spec
+
+	defaultCsNs := spec.DefaultCsNamespace
+	if defaultCsNs == "" {
+		defaultCsNs = r.DefaultCsNs
+	}
+
+	var nsLabels map[string]map[string]string
+	if nsmapping.HasSelectors(spec) {
+		nsList := &corev1.NamespaceList{}
+		if err := r.Reader.List(ctx, nsList); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to list the namespaces: %v", err)
+		}
+		nsLabels = make(map[string]map[string]string)
+		for _, ns := range nsList.Items {
+			nsLabels[ns.Name] = ns.Labels
+			if nsLabels[ns.Name] == nil {
+				nsLabels[ns.Name] = map[string]string{}
+			}
+		}
+	}
+
+	list := &odlmv1alpha1.OperandRequestList{}
+	if err := r.Reader.List(ctx, list); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list the OperandRequests: %v", err)
+	}
+
+	errs := []error{}
+	for i := range list.Items {
+		opreq := &list.Items[i]
+		if spec.ControlNamespace != "" && opreq.Namespace == spec.ControlNamespace {
+			continue
+		}
+		var target *operatorv1alpha1.NamespaceMapping
+		if nsMapping, ok := nsmapping.Find(spec, opreq.Namespace, nsLabels[opreq.Namespace]); ok {
+			target = &nsMapping
+		}
+
+		remapped := opreq.DeepCopy()
+		rewritten, err := nsmapping.RemapRequests(remapped, spec, target, defaultCsNs)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to re-map OperandRequest %s/%s: %v", opreq.Namespace, opreq.Name, err))
+			continue
+		}
+		if len(rewritten) == 0 {
+			continue
+		}
+		changes := describeRewrites(remapped, rewritten)
+
+		if r.DryRun {
+			logger.Info("Would re-map OperandRequest", "OperandRequest", opreq.Namespace+"/"+opreq.Name, "changes", changes)
+			r.Recorder.Eventf(opreq, corev1.EventTypeNormal, "RemapDryRun", "The namespace mapping %s would rewrite %s", mapping.Source, changes)
+			continue
+		}
+
+		if err := r.Client.Patch(ctx, remapped, client.MergeFromWithOptions(opreq, client.MergeFromWithOptimisticLock{})); err != nil {
+			errs = append(errs, fmt.Errorf("failed to patch OperandRequest %s/%s: %v", opreq.Namespace, opreq.Name, err))
+			continue
+		}
+		for _, rw := range rewritten {
+			metrics.OperandRequestRewrites.WithLabelValues(remapped.Spec.Requests[rw.Index].RegistryNamespace).Inc()
+		}
+		logger.Info("Re-mapped OperandRequest", "OperandRequest", opreq.Namespace+"/"+opreq.Name, "changes", changes)
+		r.Recorder.Eventf(opreq, corev1.EventTypeNormal, "Remapped", "The namespace mapping %s rewrote %s", mapping.Source, changes)
+	}
+
+	return ctrl.Result{}, utilerrors.NewAggregate(errs)
+}
+
+// describeRewrites describes the rewritten requests of opreq, e.g. "registry
+// common-service in ibm-common-services to common-service in cp4i-cs"
+func describeRewrites(opreq *odlmv1alpha1.OperandRequest, rewritten []nsmapping.RewrittenRequest) string {
+	changes := make([]string, 0, len(rewritten))
+	for _, r := range rewritten {
+		req := opreq.Spec.Requests[r.Index]
+		changes = append(changes, fmt.Sprintf("registry %s in %s to %s in %s",
+			r.Original.Registry, r.Original.RegistryNamespace, req.Registry, req.RegistryNamespace))
+	}
+	return strings.Join(changes, ", ")
+}
+
+// SetupWithManager reconciles the OperandRequests each time the mapping
+// changes, with a single request named after the mapping
+func (r *ReconcileOperandRequest) SetupWithManager(mgr ctrl.Manager) error {
+	c, err := controller.New("operandrequest-remap", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Channel{Source: r.Mappings.Changes()}, &handler.EnqueueRequestForObject{})
+}
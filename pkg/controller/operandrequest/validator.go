@@ -0,0 +1,142 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package operandrequest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/nsmapping"
+)
+
+// Validator denies the OperandRequests with a request to the Common Services
+// namespace of another tenant. It's called after the Mutator, so the requests
+// to the default Common Services namespace are already rewritten
+// +k8s:deepcopy-gen=false
+type Validator struct {
+	// Reader gets the labels of the namespace, when a mapping selects the
+	// namespaces by their labels
+	Reader client.Reader
+
+	// Mappings is the cache of the namespace mapping
+	Mappings *nsmapping.Cache
+
+	// DefaultCsNs is the Common Services namespace of the unmapped namespaces,
+	// when the mapping doesn't set its own defaultCsNs
+	DefaultCsNs string
+
+	decoder *admission.Decoder
+}
+
+// Handle validates the registryNamespace of the created and updated
+// OperandRequests. A request can point to the Common Services namespace
+// mapped for the namespace of the OperandRequest, the default one if it isn't
+// mapped, its own namespace or the control namespace. The OperandRequests of
+// the control namespace can point anywhere. On update, only the requests
+// whose registryNamespace changed are validated, so the OperandRequests
+// created before the mapping can still be updated
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := logf.FromContext(ctx)
+
+	opreq := &odlmv1alpha1.OperandRequest{}
+	if err := v.decoder.Decode(req, opreq); err != nil {
+		logger.Error(err, "Error occurred decoding OperandRequest")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	mapping, err := v.Mappings.Get()
+	if err != nil {
+		logger.Error(err, "Error occurred reading the namespace mapping")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if mapping == nil {
+		return admission.Allowed("")
+	}
+	spec := mapping.Spec
+
+	namespace := req.Namespace
+	if spec.ControlNamespace != "" && namespace == spec.ControlNamespace {
+		return admission.Allowed("")
+	}
+
+	var nsLabels map[string]string
+	if nsmapping.HasSelectors(spec) {
+		ns := &corev1.Namespace{}
+		if err := v.Reader.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			logger.Error(err, "Error occurred getting namespace", "namespace", namespace)
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		nsLabels = ns.Labels
+		if nsLabels == nil {
+			nsLabels = map[string]string{}
+		}
+	}
+
+	csNamespace := spec.DefaultCsNamespace
+	if csNamespace == "" {
+		csNamespace = v.DefaultCsNs
+	}
+	if nsMapping, ok := nsmapping.Find(spec, namespace, nsLabels); ok {
+		csNamespace = nsMapping.MapToCommonServiceNamespace
+	}
+
+	previous := make(map[string]struct{})
+	if req.Operation == admissionv1.Update {
+		oldOpreq := &odlmv1alpha1.OperandRequest{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldOpreq); err != nil {
+			logger.Error(err, "Error occurred decoding old OperandRequest")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		for _, r := range oldOpreq.Spec.Requests {
+			previous[r.RegistryNamespace] = struct{}{}
+		}
+	}
+
+	allErrs := field.ErrorList{}
+	for i, r := range opreq.Spec.Requests {
+		switch r.RegistryNamespace {
+		case "", namespace, csNamespace, spec.ControlNamespace:
+			continue
+		}
+		if _, ok := previous[r.RegistryNamespace]; ok {
+			continue
+		}
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "requests").Index(i).Child("registryNamespace"),
+			fmt.Sprintf("the OperandRequests of %s can only request operands from %s, not from %s", namespace, csNamespace, r.RegistryNamespace)))
+	}
+	if len(allErrs) > 0 {
+		return admission.Denied(allErrs.ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}
+
+// InjectDecoder injects the decoder into the Validator
+func (v *Validator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -24,15 +24,19 @@ import (
 	"reflect"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
-	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+	"github.com/IBM/ibm-common-service-webhook/pkg/audit"
+	"github.com/IBM/ibm-common-service-webhook/pkg/metrics"
+	"github.com/IBM/ibm-common-service-webhook/pkg/tracing"
 )
 
 // Mutator is the struct of webhook
@@ -45,22 +49,31 @@ type Mutator struct {
 // Handle mutates every creating pods
 func (p *Mutator) Handle(ctx context.Context, req admission.Request) admission.Response {
 
-	klog.Infof("Webhook is invoked by pod %s/%s", req.AdmissionRequest.Namespace, req.AdmissionRequest.Name)
+	logger := logf.FromContext(ctx)
 	pod := &corev1.Pod{}
 	ns := req.AdmissionRequest.Namespace
+	_, span := tracing.StartSpan(ctx, "decode")
 	err := p.decoder.Decode(req, pod)
+	tracing.EndSpan(span, err)
 	if err != nil {
-		klog.Error(err, "Error occurred decoding Pod")
+		logger.Error(err, "Error occurred decoding Pod")
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	// Pods created by controllers are only named by the API server after
+	// the admission, so the generateName identifies them in the logs
+	logger = logger.WithValues("generateName", pod.GetGenerateName())
+	ctx = logf.IntoContext(ctx, logger)
+	audit.SetGenerateName(ctx, pod.GetGenerateName())
 	copy := pod.DeepCopy()
 
 	err = p.mutatePodsFn(ctx, copy, ns)
 
 	if err != nil {
-		klog.Error(err, "Error occurred mutating Pod")
+		logger.Error(err, "Error occurred mutating Pod")
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
+	_, span = tracing.StartSpan(ctx, "generate-patch")
+	defer span.End()
 	marshaledPod, err := json.Marshal(pod)
 	marshaledcopy, err := json.Marshal(copy)
 
@@ -71,6 +84,7 @@ func (p *Mutator) Handle(ctx context.Context, req admission.Request) admission.R
 
 // Mutates function values
 func (p *Mutator) mutatePodsFn(ctx context.Context, pod *corev1.Pod, namespace string) error {
+	logger := logf.FromContext(ctx)
 
 	if _, isMirrorPod := pod.Annotations[corev1.MirrorPodAnnotationKey]; isMirrorPod {
 		return nil
@@ -79,24 +93,32 @@ func (p *Mutator) mutatePodsFn(ctx context.Context, pod *corev1.Pod, namespace s
 	// Ignore if exclusion annotation is present
 	if podAnnotations := pod.GetAnnotations(); podAnnotations != nil {
 		if podAnnotations[corev1.PodPresetOptOutAnnotationKey] == "true" {
-			klog.Infof("Pod %s has been patched", pod.Name)
+			logger.V(1).Info("Pod has opted out of PodPresets")
 			return nil
 		}
 	}
 
 	podPresetList := &operatorv1alpha1.PodPresetList{}
 
-	err := p.Client.List(ctx, podPresetList, &client.ListOptions{})
+	listCtx, span := tracing.StartSpan(ctx, "list-podpresets")
+	err := p.Client.List(listCtx, podPresetList, &client.ListOptions{})
+	span.SetAttributes(attribute.Int("podpresets", len(podPresetList.Items)))
+	tracing.EndSpan(span, err)
 
 	if err != nil {
 		return fmt.Errorf("listing pod presets failed: %v", err)
 	}
 
-	matchingPPs, err := filterPodPresets(podPresetList, pod, namespace)
+	_, span = tracing.StartSpan(ctx, "filter-podpresets")
+	matchingPPs, err := filterPodPresets(ctx, podPresetList, pod, namespace)
+	span.SetAttributes(attribute.Int("podpresets.matching", len(matchingPPs)))
+	tracing.EndSpan(span, err)
 	if err != nil {
 		return fmt.Errorf("filtering pod presets failed: %v", err)
 	}
 
+	metrics.PodPresetMatches.Observe(float64(len(matchingPPs)))
+
 	if len(matchingPPs) == 0 {
 		return nil
 	}
@@ -107,16 +129,25 @@ func (p *Mutator) mutatePodsFn(ctx context.Context, pod *corev1.Pod, namespace s
 	}
 
 	// detect merge conflict
+	_, span = tracing.StartSpan(ctx, "detect-conflicts")
 	err = safeToApplyPodPresetsOnPod(pod, matchingPPs)
+	span.SetAttributes(attribute.Bool("conflict", err != nil))
+	span.End()
 	if err != nil {
 		// conflict, ignore the error, but raise an event
-		klog.Infof("conflict occurred while applying. Podpreset names: %s; Pod Name: %s", strings.Join(presetNames, ","), pod.GetGenerateName())
+		logger.Info("Conflict occurred while applying PodPresets", "podpresets", strings.Join(presetNames, ","), "conflict", err.Error())
+		for _, pp := range matchingPPs {
+			metrics.PodPresetConflicts.WithLabelValues(pp.GetNamespace(), pp.GetName()).Inc()
+		}
 		return nil
 	}
 
 	applyPodPresetsOnPod(pod, matchingPPs)
+	for _, pp := range matchingPPs {
+		audit.AddReason(ctx, fmt.Sprintf("podpreset %s/%s", pp.GetNamespace(), pp.GetName()))
+	}
 
-	klog.Infof("applied podpresets. Podpreset names: %s; Pod Name: %s", strings.Join(presetNames, ","), pod.GetGenerateName())
+	logger.V(1).Info("Applied PodPresets", "podpresets", strings.Join(presetNames, ","))
 
 	return nil
 }
@@ -180,7 +211,7 @@ func applyPodPresetsOnContainer(ctr *corev1.Container, podPresets []*operatorv1a
 }
 
 // filterPodPresets returns list of PodPresets which match given Pod.
-func filterPodPresets(list *operatorv1alpha1.PodPresetList, pod *corev1.Pod, namespace string) ([]*operatorv1alpha1.PodPreset, error) {
+func filterPodPresets(ctx context.Context, list *operatorv1alpha1.PodPresetList, pod *corev1.Pod, namespace string) ([]*operatorv1alpha1.PodPreset, error) {
 	var matchingPPs []*operatorv1alpha1.PodPreset
 
 	for _, pp := range list.Items {
@@ -200,7 +231,7 @@ func filterPodPresets(list *operatorv1alpha1.PodPresetList, pod *corev1.Pod, nam
 		if !selector.Matches(labels.Set(pod.Labels)) {
 			continue
 		}
-		klog.Infof("PodPreset matches pod labels PodPreset: %s, Pod: %s", pp.GetName(), pod.GetGenerateName())
+		logf.FromContext(ctx).V(2).Info("PodPreset matches pod labels", "podpreset", pp.GetName())
 		matchingPPs = append(matchingPPs, &pp)
 	}
 	return matchingPPs, nil
@@ -23,17 +23,21 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/klog"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
-	"github.com/IBM/ibm-common-service-webhook/pkg/utils"
 	"github.com/IBM/ibm-common-service-webhook/pkg/webhooks"
 )
 
 const (
 	podpresetName = "cs-podpreset.operator.ibm.com"
+
+	// OptOutLabelKey is the label that excludes a pod from the pod webhook when
+	// set to "true". It's matched by the webhook object selector, so the API
+	// server doesn't call the webhook for labeled pods
+	OptOutLabelKey = "podpreset.admission.kubernetes.io/exclude"
 )
 
 // ReconcilePodPreset reconciles a PodPreset object
@@ -42,6 +46,15 @@ type ReconcilePodPreset struct {
 	// that reads objects from the cache and writes to the apiserver
 	Client client.Client
 	Scheme *runtime.Scheme
+
+	// WebhookConfig is the configuration of the webhook server, whose webhook
+	// configurations are reconciled along with the PodPresets
+	WebhookConfig *webhooks.CSWebhookConfig
+
+	// MappingNamespace is the namespace of the namespace mapping ConfigMap,
+	// labeled with its name so it's matched by the validating webhook. It's
+	// empty when the webhook is disabled
+	MappingNamespace string
 }
 
 // Reconcile reads that state of the cluster for a PodPreset object and makes changes based on the state read
@@ -52,38 +65,40 @@ type ReconcilePodPreset struct {
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
 func (r *ReconcilePodPreset) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
-	klog.Infof("Reconciling PodPreset %s/%s", request.Namespace, request.Name)
+	logger := logf.FromContext(ctx)
+	logger.Info("Reconciling PodPreset")
 
 	ns := &corev1.Namespace{}
-	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: request.Namespace}, ns)
+	err := r.Client.Get(ctx, types.NamespacedName{Name: request.Namespace}, ns)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if utils.GetEnableOpreqWebhook() {
-		if err := r.AddNameLabeltoNs("kube-public"); err != nil {
-			klog.Error(err, "Failed to add label to namespace kube-public")
+	if r.MappingNamespace != "" {
+		if err := r.AddNameLabeltoNs(ctx, r.MappingNamespace); err != nil {
+			logger.Error(err, "Failed to add label to namespace", "Namespace", r.MappingNamespace)
 			return ctrl.Result{}, err
 		}
 	}
 
+	// Label the namespace with the labels of this instance, matched by the
+	// namespace selector of its pod webhook
 	currentLabels := ns.GetLabels()
-	if len(currentLabels) == 0 {
-		ns.SetLabels(map[string]string{
-			"managed-by-common-service-webhook": "true",
-		})
-	} else {
-		currentLabels["managed-by-common-service-webhook"] = "true"
-		ns.SetLabels(currentLabels)
+	if currentLabels == nil {
+		currentLabels = map[string]string{}
 	}
+	for key, value := range r.WebhookConfig.Labels {
+		currentLabels[key] = value
+	}
+	ns.SetLabels(currentLabels)
 
-	if err := r.Client.Update(context.TODO(), ns); err != nil {
+	if err := r.Client.Update(ctx, ns); err != nil {
 		return ctrl.Result{}, err
 	}
 
 	// Fetch the PodPreset instance
 	instance := &operatorv1alpha1.PodPreset{}
-	err = r.Client.Get(context.TODO(), request.NamespacedName, instance)
+	err = r.Client.Get(ctx, request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
@@ -96,7 +111,7 @@ func (r *ReconcilePodPreset) Reconcile(ctx context.Context, request ctrl.Request
 	}
 
 	// Reconcile the webhooks
-	if err := webhooks.Config.Reconcile(context.TODO(), r.Client, instance); err != nil {
+	if err := r.WebhookConfig.Reconcile(ctx, r.Client, instance); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -109,11 +124,13 @@ func (r *ReconcilePodPreset) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
-func (r *ReconcilePodPreset) AddNameLabeltoNs(nsName string) error {
+func (r *ReconcilePodPreset) AddNameLabeltoNs(ctx context.Context, nsName string) error {
+	logger := logf.FromContext(ctx, "Namespace", nsName)
+
 	ns := &corev1.Namespace{}
-	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: nsName}, ns)
+	err := r.Client.Get(ctx, types.NamespacedName{Name: nsName}, ns)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "Failed to get namespace")
 		return err
 	}
 
@@ -125,8 +142,8 @@ func (r *ReconcilePodPreset) AddNameLabeltoNs(nsName string) error {
 		"kubernetes.io/metadata.name": nsName,
 	})
 
-	if err := r.Client.Update(context.TODO(), ns); err != nil {
-		klog.Error(err)
+	if err := r.Client.Update(ctx, ns); err != nil {
+		logger.Error(err, "Failed to add name label to namespace")
 		return err
 	}
 	return nil
@@ -0,0 +1,147 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package metrics defines the Prometheus metrics of the webhook handlers. They
+// are registered with the controller-runtime metrics registry, so they are
+// served by the manager metrics endpoint.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const namespace = "ibm_cs_webhook"
+
+// Results of an admission request
+const (
+	ResultAllowed = "allowed"
+	ResultDenied  = "denied"
+	ResultPatched = "patched"
+	ResultErrored = "errored"
+)
+
+var (
+	// AdmissionTotal counts the admission requests by webhook and result
+	AdmissionTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admission_requests_total",
+		Help:      "Total number of admission requests by webhook and result (allowed, denied, patched, errored)",
+	}, []string{"webhook", "result"})
+
+	// AdmissionDuration observes how long the webhooks take to handle an
+	// admission request
+	AdmissionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "admission_duration_seconds",
+		Help:      "Time taken to handle an admission request by webhook",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"webhook"})
+
+	// PodPresetMatches observes the number of PodPresets matching each
+	// admitted pod
+	PodPresetMatches = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "podpreset_matches",
+		Help:      "Number of PodPresets matching an admitted pod",
+		Buckets:   []float64{0, 1, 2, 3, 5, 10},
+	})
+
+	// PodPresetConflicts counts the PodPresets that were not applied to a pod
+	// because of a merge conflict
+	PodPresetConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "podpreset_conflicts_total",
+		Help:      "Total number of merge conflicts by PodPreset",
+	}, []string{"namespace", "podpreset"})
+
+	// OperandRequestRewrites counts the OperandRequest registryNamespace
+	// rewrites by target namespace
+	OperandRequestRewrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operandrequest_rewrites_total",
+		Help:      "Total number of OperandRequest registryNamespace rewrites by target namespace",
+	}, []string{"target_namespace"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		AdmissionTotal,
+		AdmissionDuration,
+		PodPresetMatches,
+		PodPresetConflicts,
+		OperandRequestRewrites,
+	)
+}
+
+// InstrumentedHandler records the result and the latency of every admission
+// request handled by Handler
+// +k8s:deepcopy-gen=false
+type InstrumentedHandler struct {
+	Name    string
+	Handler admission.Handler
+}
+
+// InstrumentHandler wraps handler so its admission requests are recorded under
+// the given webhook name
+func InstrumentHandler(name string, handler admission.Handler) *InstrumentedHandler {
+	return &InstrumentedHandler{
+		Name:    name,
+		Handler: handler,
+	}
+}
+
+// Handle calls the wrapped handler and records its response
+func (h *InstrumentedHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	start := time.Now()
+	resp := h.Handler.Handle(ctx, req)
+
+	AdmissionDuration.WithLabelValues(h.Name).Observe(time.Since(start).Seconds())
+	AdmissionTotal.WithLabelValues(h.Name, ResultOf(resp)).Inc()
+
+	return resp
+}
+
+// ResultOf classifies an admission response as allowed, denied, patched or errored
+func ResultOf(resp admission.Response) string {
+	if !resp.Allowed {
+		if resp.Result != nil && resp.Result.Code != http.StatusForbidden {
+			return ResultErrored
+		}
+		return ResultDenied
+	}
+	if len(resp.Patches) > 0 {
+		return ResultPatched
+	}
+	return ResultAllowed
+}
+
+// InjectDecoder injects the decoder into the wrapped handler
+func (h *InstrumentedHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
+// InjectFunc injects the dependencies into the wrapped handler
+func (h *InstrumentedHandler) InjectFunc(f inject.Func) error {
+	return f(h.Handler)
+}
@@ -0,0 +1,260 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+var log = logf.Log.WithName("nsmapping")
+
+// Mapping is the parsed namespace mapping, and the object it's read from
+// +k8s:deepcopy-gen=false
+type Mapping struct {
+	// Source is the object the mapping is read from, e.g.
+	// "CommonServiceNamespaceMapping common-service-maps"
+	Source string
+
+	Spec *operatorv1alpha1.CommonServiceNamespaceMappingSpec
+}
+
+// entry is the last parsed version of an object
+type entry struct {
+	resourceVersion string
+	mapping         *Mapping
+	err             error
+}
+
+// Cache keeps the namespace mapping parsed from informers of the
+// CommonServiceNamespaceMapping and of the ConfigMap. An object is parsed
+// again only when its resourceVersion changes. It runs in every replica, as
+// all of them serve the admission requests
+// +k8s:deepcopy-gen=false
+type Cache struct {
+	// Name of the CommonServiceNamespaceMapping, which takes precedence over
+	// the ConfigMap
+	Name string
+
+	// ConfigMap is the legacy namespace mapping ConfigMap
+	ConfigMap types.NamespacedName
+
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+
+	// RESTMapper finds whether the CommonServiceNamespaceMapping CRD is
+	// installed. Only the ConfigMap is watched when it isn't
+	RESTMapper meta.RESTMapper
+
+	mu      sync.RWMutex
+	cr      entry
+	cm      entry
+	synced  bool
+	changes chan event.GenericEvent
+}
+
+// Get returns the namespace mapping, from the CommonServiceNamespaceMapping
+// if it exists or from the ConfigMap otherwise. The mapping is nil when
+// neither exists, and the error is the one of parsing the object it's read
+// from. A CommonServiceNamespaceMapping that fails to parse doesn't fall back
+// to the ConfigMap, so the admission requests fail instead of being served
+// with a stale mapping
+func (c *Cache) Get() (*Mapping, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.synced {
+		return nil, fmt.Errorf("the namespace mapping cache has not synced")
+	}
+	if c.cr.resourceVersion != "" {
+		return c.cr.mapping, c.cr.err
+	}
+	return c.cm.mapping, c.cm.err
+}
+
+// Changes returns a channel notified when the mapping is synced and each time
+// it changes afterwards, to be watched with a source.Channel. Consecutive
+// changes are coalesced into a single event of the mapping name
+func (c *Cache) Changes() <-chan event.GenericEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changes == nil {
+		c.changes = make(chan event.GenericEvent, 1)
+	}
+	return c.changes
+}
+
+// notify sends a change event unless one is already pending. c.mu must be
+// held
+func (c *Cache) notify() {
+	if c.changes == nil || !c.synced {
+		return
+	}
+	select {
+	case c.changes <- event.GenericEvent{Object: &operatorv1alpha1.CommonServiceNamespaceMapping{ObjectMeta: metav1.ObjectMeta{Name: c.Name}}}:
+	default:
+	}
+}
+
+// NeedLeaderElection returns false, so every replica runs the informers
+func (c *Cache) NeedLeaderElection() bool {
+	return false
+}
+
+// Start runs the informers until ctx is done
+func (c *Cache) Start(ctx context.Context) error {
+	tweak := func(name string) func(*metav1.ListOptions) {
+		return func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}
+	}
+
+	cmFactory := informers.NewSharedInformerFactoryWithOptions(c.Clientset, 0,
+		informers.WithNamespace(c.ConfigMap.Namespace),
+		informers.WithTweakListOptions(tweak(c.ConfigMap.Name)),
+	)
+	cmInformer := cmFactory.Core().V1().ConfigMaps().Informer()
+	cmInformer.AddEventHandler(c.handler(&c.cm, c.parseConfigMap))
+	cmFactory.Start(ctx.Done())
+	syncs := []toolscache.InformerSynced{cmInformer.HasSynced}
+
+	gvk := operatorv1alpha1.SchemeGroupVersion.WithKind("CommonServiceNamespaceMapping")
+	mapping, err := c.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	switch {
+	case meta.IsNoMatchError(err):
+		log.Info("CommonServiceNamespaceMapping CRD is not installed, reading the mapping from the ConfigMap", "ConfigMap", c.ConfigMap)
+	case err != nil:
+		return err
+	default:
+		crFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.Dynamic, 0, metav1.NamespaceAll, tweak(c.Name))
+		crInformer := crFactory.ForResource(mapping.Resource).Informer()
+		crInformer.AddEventHandler(c.handler(&c.cr, c.parseMapping))
+		crFactory.Start(ctx.Done())
+		syncs = append(syncs, crInformer.HasSynced)
+	}
+
+	if !toolscache.WaitForCacheSync(ctx.Done(), syncs...) {
+		return nil
+	}
+	c.mu.Lock()
+	c.synced = true
+	c.notify()
+	c.mu.Unlock()
+	log.Info("Namespace mapping cache synced")
+
+	<-ctx.Done()
+	return nil
+}
+
+// Checker checks that the cache has synced, so admission requests are only
+// routed to the pod once the mapping is read
+func (c *Cache) Checker() healthz.Checker {
+	return func(_ *http.Request) error {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if !c.synced {
+			return fmt.Errorf("the namespace mapping cache has not synced")
+		}
+		return nil
+	}
+}
+
+// handler updates e with the objects of an informer, parsed with parse
+func (c *Cache) handler(e *entry, parse func(obj interface{}) (*Mapping, error)) toolscache.ResourceEventHandler {
+	update := func(obj interface{}) {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return
+		}
+
+		c.mu.RLock()
+		unchanged := e.resourceVersion == accessor.GetResourceVersion()
+		c.mu.RUnlock()
+		if unchanged {
+			return
+		}
+
+		mapping, err := parse(obj)
+		if err != nil {
+			log.Error(err, "Failed to parse the namespace mapping", "name", accessor.GetName())
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		*e = entry{
+			resourceVersion: accessor.GetResourceVersion(),
+			mapping:         mapping,
+			err:             err,
+		}
+		c.notify()
+	}
+
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj interface{}) { update(obj) },
+		DeleteFunc: func(_ interface{}) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			*e = entry{}
+			c.notify()
+		},
+	}
+}
+
+func (c *Cache) parseConfigMap(obj interface{}) (*Mapping, error) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T", obj)
+	}
+	spec, err := ParseConfigMap(cm)
+	if err != nil {
+		return nil, err
+	}
+	return &Mapping{Source: fmt.Sprintf("ConfigMap %s", c.ConfigMap), Spec: spec}, nil
+}
+
+func (c *Cache) parseMapping(obj interface{}) (*Mapping, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T", obj)
+	}
+	mapping := &operatorv1alpha1.CommonServiceNamespaceMapping{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, mapping); err != nil {
+		return nil, err
+	}
+	return &Mapping{Source: fmt.Sprintf("CommonServiceNamespaceMapping %s", mapping.Name), Spec: &mapping.Spec}, nil
+}
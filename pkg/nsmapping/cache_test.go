@@ -0,0 +1,77 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"fmt"
+	"testing"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+func TestCacheGet(t *testing.T) {
+	crMapping := &Mapping{Source: "CommonServiceNamespaceMapping common-service-maps", Spec: &operatorv1alpha1.CommonServiceNamespaceMappingSpec{}}
+	cmMapping := &Mapping{Source: "ConfigMap kube-public/common-service-maps", Spec: &operatorv1alpha1.CommonServiceNamespaceMappingSpec{}}
+	parseErr := fmt.Errorf("parse error")
+
+	tests := []struct {
+		name    string
+		cr      entry
+		cm      entry
+		want    *Mapping
+		wantErr error
+	}{
+		{
+			name: "CommonServiceNamespaceMapping takes precedence",
+			cr:   entry{resourceVersion: "1", mapping: crMapping},
+			cm:   entry{resourceVersion: "1", mapping: cmMapping},
+			want: crMapping,
+		},
+		{
+			name:    "invalid CommonServiceNamespaceMapping doesn't fall back to the ConfigMap",
+			cr:      entry{resourceVersion: "1", err: parseErr},
+			cm:      entry{resourceVersion: "1", mapping: cmMapping},
+			wantErr: parseErr,
+		},
+		{
+			name: "ConfigMap",
+			cm:   entry{resourceVersion: "1", mapping: cmMapping},
+			want: cmMapping,
+		},
+		{
+			name:    "invalid ConfigMap",
+			cm:      entry{resourceVersion: "1", err: parseErr},
+			wantErr: parseErr,
+		},
+		{
+			name: "no mapping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cache{cr: tt.cr, cm: tt.cm, synced: true}
+			got, err := c.Get()
+			if err != tt.wantErr {
+				t.Errorf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package nsmapping reads the common service namespace mapping, from the
+// CommonServiceNamespaceMapping or from the legacy common-service-maps
+// ConfigMap. Both are parsed into a CommonServiceNamespaceMappingSpec and
+// validated by Validate, so the handlers that read and validate the mapping
+// never disagree.
+package nsmapping
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+// ConfigMapKey is the key of the mapping in the data of the ConfigMap
+const ConfigMapKey = "common-service-maps.yaml"
+
+// configMapMapping is the schema of the mapping in the ConfigMap
+type configMapMapping struct {
+	ControlNamespace string                      `json:"controlNamespace,omitempty"`
+	DefaultCsNs      string                      `json:"defaultCsNs,omitempty"`
+	NamespaceMapping []configMapNamespaceMapping `json:"namespaceMapping,omitempty"`
+}
+
+type configMapNamespaceMapping struct {
+	RequestedFromNamespace      []string              `json:"requested-from-namespace,omitempty"`
+	NamespaceSelector           *metav1.LabelSelector `json:"namespace-selector,omitempty"`
+	MapToCommonServiceNamespace string                `json:"map-to-common-service-namespace"`
+	Rewrite                     *configMapRewrite     `json:"rewrite,omitempty"`
+}
+
+type configMapRewrite struct {
+	Registries        map[string]string `json:"registries,omitempty"`
+	Bindings          map[string]string `json:"bindings,omitempty"`
+	OperandNamespaces bool              `json:"operand-namespaces,omitempty"`
+}
+
+// ParseConfigMap parses the mapping in the data of the ConfigMap
+func ParseConfigMap(cm *corev1.ConfigMap) (*operatorv1alpha1.CommonServiceNamespaceMappingSpec, error) {
+	return Parse(cm.Data[ConfigMapKey])
+}
+
+// ParseConfigMapStrict parses the mapping in the data of the ConfigMap,
+// rejecting unknown keys
+func ParseConfigMapStrict(cm *corev1.ConfigMap) (*operatorv1alpha1.CommonServiceNamespaceMappingSpec, error) {
+	return ParseStrict(cm.Data[ConfigMapKey])
+}
+
+// Parse parses the YAML mapping of the ConfigMap. Unknown keys are ignored,
+// so the mappings accepted before they were validated are still read
+func Parse(data string) (*operatorv1alpha1.CommonServiceNamespaceMappingSpec, error) {
+	var mapping configMapMapping
+	if err := utilyaml.Unmarshal([]byte(data), &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", ConfigMapKey, err)
+	}
+	return toSpec(mapping), nil
+}
+
+// ParseStrict parses the YAML mapping of the ConfigMap, rejecting unknown
+// keys, e.g. a misspelled namespaceMapping
+func ParseStrict(data string) (*operatorv1alpha1.CommonServiceNamespaceMappingSpec, error) {
+	var mapping configMapMapping
+	if err := utilyaml.UnmarshalStrict([]byte(data), &mapping, utilyaml.DisallowUnknownFields); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", ConfigMapKey, err)
+	}
+	return toSpec(mapping), nil
+}
+
+func toSpec(mapping configMapMapping) *operatorv1alpha1.CommonServiceNamespaceMappingSpec {
+	spec := &operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+		ControlNamespace:   mapping.ControlNamespace,
+		DefaultCsNamespace: mapping.DefaultCsNs,
+	}
+	for _, nsMapping := range mapping.NamespaceMapping {
+		var rewrite *operatorv1alpha1.RequestRewrite
+		if nsMapping.Rewrite != nil {
+			rewrite = &operatorv1alpha1.RequestRewrite{
+				Registries:        nsMapping.Rewrite.Registries,
+				Bindings:          nsMapping.Rewrite.Bindings,
+				OperandNamespaces: nsMapping.Rewrite.OperandNamespaces,
+			}
+		}
+		spec.NamespaceMappings = append(spec.NamespaceMappings, operatorv1alpha1.NamespaceMapping{
+			RequestedFromNamespaces:     nsMapping.RequestedFromNamespace,
+			NamespaceSelector:           nsMapping.NamespaceSelector,
+			MapToCommonServiceNamespace: nsMapping.MapToCommonServiceNamespace,
+			Rewrite:                     rewrite,
+		})
+	}
+	return spec
+}
+
+// IsPattern returns whether the requested-from namespace is a glob pattern,
+// where "*" matches any sequence of characters and "?" any single character
+func IsPattern(ns string) bool {
+	return strings.ContainsAny(ns, "*?")
+}
+
+// specificity is the number of literal characters of a pattern. The most
+// specific pattern matching a namespace takes precedence
+func specificity(pattern string) int {
+	return len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+}
+
+// matchPattern returns whether the glob pattern matches the namespace
+func matchPattern(pattern, namespace string) bool {
+	matched, err := path.Match(pattern, namespace)
+	return err == nil && matched
+}
+
+// HasSelectors returns whether a mapping has a namespace selector, so the
+// labels of the namespaces are needed to find their mapping
+func HasSelectors(spec *operatorv1alpha1.CommonServiceNamespaceMappingSpec) bool {
+	for _, nsMapping := range spec.NamespaceMappings {
+		if nsMapping.NamespaceSelector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the mapping of the namespace. A mapping listing the name of the
+// namespace, or mapping to it, takes precedence over the patterns, and the
+// most specific pattern, the one with the most literal characters, over the
+// namespace selectors. Ties are broken by the order of the mappings. The
+// selectors are only matched against nsLabels when it isn't nil
+func Find(spec *operatorv1alpha1.CommonServiceNamespaceMappingSpec, namespace string, nsLabels map[string]string) (operatorv1alpha1.NamespaceMapping, bool) {
+	for _, nsMapping := range spec.NamespaceMappings {
+		if nsMapping.MapToCommonServiceNamespace == namespace {
+			return nsMapping, true
+		}
+		for _, ns := range nsMapping.RequestedFromNamespaces {
+			if ns == namespace {
+				return nsMapping, true
+			}
+		}
+	}
+
+	found, best := -1, -1
+	for i, nsMapping := range spec.NamespaceMappings {
+		for _, ns := range nsMapping.RequestedFromNamespaces {
+			if IsPattern(ns) && specificity(ns) > best && matchPattern(ns, namespace) {
+				found, best = i, specificity(ns)
+			}
+		}
+	}
+	if found >= 0 {
+		return spec.NamespaceMappings[found], true
+	}
+
+	if nsLabels != nil {
+		for _, nsMapping := range spec.NamespaceMappings {
+			if nsMapping.NamespaceSelector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(nsMapping.NamespaceSelector)
+			if err == nil && selector.Matches(labels.Set(nsLabels)) {
+				return nsMapping, true
+			}
+		}
+	}
+
+	return operatorv1alpha1.NamespaceMapping{}, false
+}
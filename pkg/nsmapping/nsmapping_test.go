@@ -0,0 +1,124 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+func TestFind(t *testing.T) {
+	tenantSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}}
+	spec := &operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+		ControlNamespace: "cs-control",
+		NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+			{RequestedFromNamespaces: []string{"team-*"}, MapToCommonServiceNamespace: "cs-team"},
+			{RequestedFromNamespaces: []string{"team-a-*"}, MapToCommonServiceNamespace: "cs-team-a"},
+			{RequestedFromNamespaces: []string{"team-a-dev", "*-test"}, MapToCommonServiceNamespace: "cs-dev"},
+			{RequestedFromNamespaces: []string{"*-prod"}, MapToCommonServiceNamespace: "cs-prod"},
+			{RequestedFromNamespaces: []string{"app-?-prod"}, MapToCommonServiceNamespace: "cs-app"},
+			{NamespaceSelector: tenantSelector, MapToCommonServiceNamespace: "cs-tenant-a"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "name takes precedence over the patterns",
+			namespace: "team-a-dev",
+			want:      "cs-dev",
+			wantFound: true,
+		},
+		{
+			name:      "Common Services namespace maps to itself",
+			namespace: "cs-team-a",
+			want:      "cs-team-a",
+			wantFound: true,
+		},
+		{
+			name:      "most specific of overlapping patterns",
+			namespace: "team-a-qa",
+			want:      "cs-team-a",
+			wantFound: true,
+		},
+		{
+			name:      "less specific pattern",
+			namespace: "team-b",
+			want:      "cs-team",
+			wantFound: true,
+		},
+		{
+			name:      "pattern with a single character wildcard",
+			namespace: "app-1-prod",
+			want:      "cs-app",
+			wantFound: true,
+		},
+		{
+			name:      "ties are broken by the order of the mappings",
+			namespace: "team-test",
+			want:      "cs-team",
+			wantFound: true,
+		},
+		{
+			name:      "pattern takes precedence over the selectors",
+			namespace: "team-c",
+			labels:    map[string]string{"tenant": "a"},
+			want:      "cs-team",
+			wantFound: true,
+		},
+		{
+			name:      "selector",
+			namespace: "billing",
+			labels:    map[string]string{"tenant": "a"},
+			want:      "cs-tenant-a",
+			wantFound: true,
+		},
+		{
+			name:      "selector not matching",
+			namespace: "billing",
+			labels:    map[string]string{"tenant": "b"},
+		},
+		{
+			name:      "selectors ignored without labels",
+			namespace: "billing",
+		},
+		{
+			name:      "control namespace",
+			namespace: "cs-control",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := Find(spec, tt.namespace, tt.labels)
+			if found != tt.wantFound {
+				t.Fatalf("Find() found = %v, want %v", found, tt.wantFound)
+			}
+			if got.MapToCommonServiceNamespace != tt.want {
+				t.Errorf("Find() = %s, want %s", got.MapToCommonServiceNamespace, tt.want)
+			}
+		})
+	}
+}
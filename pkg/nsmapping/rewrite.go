@@ -0,0 +1,236 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+// OriginalRequestsAnnotation records the requests of an OperandRequest as they
+// were before the namespace mapping rewrote them, in a JSON object keyed by
+// their index at the time of the rewrite, so it can be audited and reverted
+const OriginalRequestsAnnotation = "operator.ibm.com/namespace-mapping-original-requests"
+
+// RewrittenRequest is a request of an OperandRequest rewritten by a mapping
+// +k8s:deepcopy-gen=false
+type RewrittenRequest struct {
+	Index    int
+	Original odlmv1alpha1.Request
+}
+
+// RewriteRequests rewrites the requests of opreq to the default Common
+// Services namespace, so they point to the Common Services namespace of the
+// mapping, along with the fields configured in its Rewrite. The original
+// requests are recorded in the OriginalRequestsAnnotation
+func RewriteRequests(opreq *odlmv1alpha1.OperandRequest, nsMapping operatorv1alpha1.NamespaceMapping, defaultCsNs string) ([]RewrittenRequest, error) {
+	rewritten := []RewrittenRequest{}
+	for i := range opreq.Spec.Requests {
+		req := &opreq.Spec.Requests[i]
+		if req.RegistryNamespace != defaultCsNs {
+			continue
+		}
+		original := req.DeepCopy()
+		if err := rewriteRequest(req, nsMapping, defaultCsNs); err != nil {
+			return nil, fmt.Errorf("failed to rewrite the request to %s: %v", req.Registry, err)
+		}
+		rewritten = append(rewritten, RewrittenRequest{Index: i, Original: *original})
+	}
+
+	if len(rewritten) > 0 {
+		if err := recordOriginals(opreq, rewritten); err != nil {
+			return nil, err
+		}
+	}
+	return rewritten, nil
+}
+
+func rewriteRequest(req *odlmv1alpha1.Request, nsMapping operatorv1alpha1.NamespaceMapping, defaultCsNs string) error {
+	req.RegistryNamespace = nsMapping.MapToCommonServiceNamespace
+
+	rewrite := nsMapping.Rewrite
+	if rewrite == nil {
+		return nil
+	}
+	if registry, ok := rewrite.Registries[req.Registry]; ok {
+		req.Registry = registry
+	}
+	for i := range req.Operands {
+		operand := &req.Operands[i]
+		for key, binding := range operand.Bindings {
+			if name, ok := rewrite.Bindings[binding.Secret]; ok && binding.Secret != "" {
+				binding.Secret = name
+			}
+			if name, ok := rewrite.Bindings[binding.Configmap]; ok && binding.Configmap != "" {
+				binding.Configmap = name
+			}
+			operand.Bindings[key] = binding
+		}
+		if rewrite.OperandNamespaces && len(operand.Spec.Raw) > 0 {
+			raw, err := replaceValue(operand.Spec.Raw, defaultCsNs, nsMapping.MapToCommonServiceNamespace)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite the spec of operand %s: %v", operand.Name, err)
+			}
+			operand.Spec.Raw = raw
+		}
+	}
+	return nil
+}
+
+// replaceValue replaces the string values of the JSON document that are old
+// with new. The document is returned as is when no value is replaced
+func replaceValue(raw []byte, old, new string) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	replaced := false
+	var walk func(value interface{}) interface{}
+	walk = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if v == old {
+				replaced = true
+				return new
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				v[key] = walk(item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = walk(item)
+			}
+		}
+		return value
+	}
+	doc = walk(doc)
+
+	if !replaced {
+		return raw, nil
+	}
+	return json.Marshal(doc)
+}
+
+// RemapRequests rewrites the requests of opreq so they follow the current
+// mapping, nsMapping being nil when the namespace of opreq isn't mapped.
+// Unlike RewriteRequests, it also rewrites the requests that point to a
+// Common Services namespace the namespace was mapped to before, i.e. the ones
+// recorded in the OriginalRequestsAnnotation and the ones pointing to the
+// Common Services namespace of another mapping. They are restored from the
+// annotation, or pointed back to the default Common Services namespace, before
+// being rewritten with nsMapping. The returned requests are the ones before
+// the remapping
+func RemapRequests(opreq *odlmv1alpha1.OperandRequest, spec *operatorv1alpha1.CommonServiceNamespaceMappingSpec, nsMapping *operatorv1alpha1.NamespaceMapping, defaultCsNs string) ([]RewrittenRequest, error) {
+	target := defaultCsNs
+	if nsMapping != nil {
+		target = nsMapping.MapToCommonServiceNamespace
+	}
+	csNamespaces := make(map[string]struct{})
+	for _, m := range spec.NamespaceMappings {
+		csNamespaces[m.MapToCommonServiceNamespace] = struct{}{}
+	}
+	originals := readOriginals(opreq)
+
+	remapped := []RewrittenRequest{}
+	for i := range opreq.Spec.Requests {
+		req := &opreq.Spec.Requests[i]
+		if req.RegistryNamespace == target {
+			continue
+		}
+		original, recorded := originals[strconv.Itoa(i)]
+		_, mapped := csNamespaces[req.RegistryNamespace]
+		if req.RegistryNamespace != defaultCsNs && !recorded && !mapped {
+			continue
+		}
+
+		before := req.DeepCopy()
+		if recorded {
+			*req = *original.DeepCopy()
+		} else {
+			req.RegistryNamespace = defaultCsNs
+		}
+		delete(originals, strconv.Itoa(i))
+		if nsMapping != nil {
+			unmapped := req.DeepCopy()
+			if err := rewriteRequest(req, *nsMapping, defaultCsNs); err != nil {
+				return nil, fmt.Errorf("failed to rewrite the request to %s: %v", req.Registry, err)
+			}
+			originals[strconv.Itoa(i)] = *unmapped
+		}
+		remapped = append(remapped, RewrittenRequest{Index: i, Original: *before})
+	}
+
+	if len(remapped) > 0 {
+		if err := writeOriginals(opreq, originals); err != nil {
+			return nil, err
+		}
+	}
+	return remapped, nil
+}
+
+// recordOriginals adds the original requests to the
+// OriginalRequestsAnnotation. The requests already recorded are kept, as
+// they were rewritten earlier
+func recordOriginals(opreq *odlmv1alpha1.OperandRequest, rewritten []RewrittenRequest) error {
+	originals := readOriginals(opreq)
+	for _, r := range rewritten {
+		index := strconv.Itoa(r.Index)
+		if _, ok := originals[index]; !ok {
+			originals[index] = r.Original
+		}
+	}
+	return writeOriginals(opreq, originals)
+}
+
+// readOriginals returns the requests recorded in the
+// OriginalRequestsAnnotation, keyed by their index. An invalid annotation is
+// replaced
+func readOriginals(opreq *odlmv1alpha1.OperandRequest) map[string]odlmv1alpha1.Request {
+	originals := make(map[string]odlmv1alpha1.Request)
+	if value, ok := opreq.Annotations[OriginalRequestsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(value), &originals); err != nil {
+			log.Info("Replacing the invalid annotation", "annotation", OriginalRequestsAnnotation, "OperandRequest", opreq.Namespace+"/"+opreq.Name)
+			return make(map[string]odlmv1alpha1.Request)
+		}
+	}
+	return originals
+}
+
+// writeOriginals sets the OriginalRequestsAnnotation to originals, or
+// removes it when there are none
+func writeOriginals(opreq *odlmv1alpha1.OperandRequest, originals map[string]odlmv1alpha1.Request) error {
+	if len(originals) == 0 {
+		delete(opreq.Annotations, OriginalRequestsAnnotation)
+		return nil
+	}
+	value, err := json.Marshal(originals)
+	if err != nil {
+		return fmt.Errorf("failed to record the original requests: %v", err)
+	}
+	if opreq.Annotations == nil {
+		opreq.Annotations = make(map[string]string)
+	}
+	opreq.Annotations[OriginalRequestsAnnotation] = string(value)
+	return nil
+}
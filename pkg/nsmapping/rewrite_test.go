@@ -0,0 +1,265 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+const testDefaultCsNs = "ibm-common-services"
+
+func newRequest(registry, registryNamespace string) odlmv1alpha1.Request {
+	return odlmv1alpha1.Request{
+		Registry:          registry,
+		RegistryNamespace: registryNamespace,
+		Operands: []odlmv1alpha1.Operand{
+			{
+				Name: "ibm-iam-operator",
+				Bindings: map[string]odlmv1alpha1.SecretConfigmap{
+					"public": {Secret: "iam-secret", Configmap: "iam-config"},
+				},
+				Spec: runtime.RawExtension{Raw: []byte(`{"namespace":"` + registryNamespace + `"}`)},
+			},
+		},
+	}
+}
+
+func newOperandRequest(annotations map[string]string, requests ...odlmv1alpha1.Request) *odlmv1alpha1.OperandRequest {
+	opreq := &odlmv1alpha1.OperandRequest{}
+	opreq.Namespace = "team-a"
+	opreq.Name = "opreq"
+	opreq.Annotations = annotations
+	opreq.Spec.Requests = requests
+	return opreq
+}
+
+func originalsAnnotation(t *testing.T, originals map[string]odlmv1alpha1.Request) string {
+	t.Helper()
+	value, err := json.Marshal(originals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(value)
+}
+
+func TestRewriteRequests(t *testing.T) {
+	nsMapping := operatorv1alpha1.NamespaceMapping{
+		RequestedFromNamespaces:     []string{"team-a"},
+		MapToCommonServiceNamespace: "cs-team-a",
+	}
+	rewriting := nsMapping
+	rewriting.Rewrite = &operatorv1alpha1.RequestRewrite{
+		Registries:        map[string]string{"common-service": "common-service-a"},
+		Bindings:          map[string]string{"iam-secret": "iam-secret-a"},
+		OperandNamespaces: true,
+	}
+
+	rewritten := newRequest("common-service-a", "cs-team-a")
+	rewritten.Operands[0].Bindings["public"] = odlmv1alpha1.SecretConfigmap{Secret: "iam-secret-a", Configmap: "iam-config"}
+	rewritten.Operands[0].Spec.Raw = []byte(`{"namespace":"cs-team-a"}`)
+
+	tests := []struct {
+		name          string
+		nsMapping     operatorv1alpha1.NamespaceMapping
+		opreq         *odlmv1alpha1.OperandRequest
+		wantRequests  []odlmv1alpha1.Request
+		wantIndexes   []int
+		wantOriginals map[string]odlmv1alpha1.Request
+	}{
+		{
+			name:      "request to the default Common Services namespace",
+			nsMapping: nsMapping,
+			opreq: newOperandRequest(nil,
+				newRequest("common-service", testDefaultCsNs),
+				newRequest("other", "team-a")),
+			wantRequests: []odlmv1alpha1.Request{
+				func() odlmv1alpha1.Request {
+					req := newRequest("common-service", testDefaultCsNs)
+					req.RegistryNamespace = "cs-team-a"
+					return req
+				}(),
+				newRequest("other", "team-a"),
+			},
+			wantIndexes:   []int{0},
+			wantOriginals: map[string]odlmv1alpha1.Request{"0": newRequest("common-service", testDefaultCsNs)},
+		},
+		{
+			name:          "registries, bindings and operand namespaces",
+			nsMapping:     rewriting,
+			opreq:         newOperandRequest(nil, newRequest("common-service", testDefaultCsNs)),
+			wantRequests:  []odlmv1alpha1.Request{rewritten},
+			wantIndexes:   []int{0},
+			wantOriginals: map[string]odlmv1alpha1.Request{"0": newRequest("common-service", testDefaultCsNs)},
+		},
+		{
+			name:      "recorded originals are kept",
+			nsMapping: nsMapping,
+			opreq: func() *odlmv1alpha1.OperandRequest {
+				earlier := newRequest("earlier", testDefaultCsNs)
+				annotations := map[string]string{OriginalRequestsAnnotation: originalsAnnotation(t, map[string]odlmv1alpha1.Request{"0": earlier})}
+				return newOperandRequest(annotations, newRequest("common-service", testDefaultCsNs))
+			}(),
+			wantRequests: []odlmv1alpha1.Request{
+				func() odlmv1alpha1.Request {
+					req := newRequest("common-service", testDefaultCsNs)
+					req.RegistryNamespace = "cs-team-a"
+					return req
+				}(),
+			},
+			wantIndexes:   []int{0},
+			wantOriginals: map[string]odlmv1alpha1.Request{"0": newRequest("earlier", testDefaultCsNs)},
+		},
+		{
+			name:         "nothing to rewrite",
+			nsMapping:    nsMapping,
+			opreq:        newOperandRequest(nil, newRequest("other", "team-a")),
+			wantRequests: []odlmv1alpha1.Request{newRequest("other", "team-a")},
+			wantIndexes:  []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RewriteRequests(tt.opreq, tt.nsMapping, testDefaultCsNs)
+			if err != nil {
+				t.Fatalf("RewriteRequests() error = %v", err)
+			}
+			indexes := []int{}
+			for _, r := range got {
+				indexes = append(indexes, r.Index)
+			}
+			if !reflect.DeepEqual(indexes, tt.wantIndexes) {
+				t.Errorf("RewriteRequests() indexes = %v, want %v", indexes, tt.wantIndexes)
+			}
+			if !reflect.DeepEqual(tt.opreq.Spec.Requests, tt.wantRequests) {
+				t.Errorf("requests = %+v, want %+v", tt.opreq.Spec.Requests, tt.wantRequests)
+			}
+			_, recorded := tt.opreq.Annotations[OriginalRequestsAnnotation]
+			if recorded != (tt.wantOriginals != nil) {
+				t.Fatalf("annotation recorded = %v, want %v", recorded, tt.wantOriginals != nil)
+			}
+			if tt.wantOriginals != nil && !reflect.DeepEqual(readOriginals(tt.opreq), tt.wantOriginals) {
+				t.Errorf("originals = %+v, want %+v", readOriginals(tt.opreq), tt.wantOriginals)
+			}
+		})
+	}
+}
+
+func TestRemapRequests(t *testing.T) {
+	spec := &operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+		NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+			{RequestedFromNamespaces: []string{"team-a"}, MapToCommonServiceNamespace: "cs-team-a"},
+			{RequestedFromNamespaces: []string{"team-b"}, MapToCommonServiceNamespace: "cs-team-b"},
+		},
+	}
+	original := newRequest("common-service", testDefaultCsNs)
+	recorded := func() map[string]string {
+		return map[string]string{OriginalRequestsAnnotation: originalsAnnotation(t, map[string]odlmv1alpha1.Request{"0": original})}
+	}
+	mappedTo := func(csNamespace string) odlmv1alpha1.Request {
+		req := newRequest("common-service", testDefaultCsNs)
+		req.RegistryNamespace = csNamespace
+		return req
+	}
+
+	tests := []struct {
+		name          string
+		nsMapping     *operatorv1alpha1.NamespaceMapping
+		opreq         *odlmv1alpha1.OperandRequest
+		wantRequests  []odlmv1alpha1.Request
+		wantIndexes   []int
+		wantOriginals map[string]odlmv1alpha1.Request
+	}{
+		{
+			name:          "namespace mapped after the OperandRequest",
+			nsMapping:     &spec.NamespaceMappings[0],
+			opreq:         newOperandRequest(nil, original),
+			wantRequests:  []odlmv1alpha1.Request{mappedTo("cs-team-a")},
+			wantIndexes:   []int{0},
+			wantOriginals: map[string]odlmv1alpha1.Request{"0": original},
+		},
+		{
+			name:          "namespace moved to another mapping",
+			nsMapping:     &spec.NamespaceMappings[1],
+			opreq:         newOperandRequest(recorded(), mappedTo("cs-team-a")),
+			wantRequests:  []odlmv1alpha1.Request{mappedTo("cs-team-b")},
+			wantIndexes:   []int{0},
+			wantOriginals: map[string]odlmv1alpha1.Request{"0": original},
+		},
+		{
+			name:         "namespace removed from the mapping",
+			opreq:        newOperandRequest(recorded(), mappedTo("cs-team-a")),
+			wantRequests: []odlmv1alpha1.Request{original},
+			wantIndexes:  []int{0},
+		},
+		{
+			name:         "request to the Common Services namespace of another mapping without annotation",
+			opreq:        newOperandRequest(nil, mappedTo("cs-team-b")),
+			wantRequests: []odlmv1alpha1.Request{original},
+			wantIndexes:  []int{0},
+		},
+		{
+			name:          "request already mapped",
+			nsMapping:     &spec.NamespaceMappings[0],
+			opreq:         newOperandRequest(recorded(), mappedTo("cs-team-a")),
+			wantRequests:  []odlmv1alpha1.Request{mappedTo("cs-team-a")},
+			wantIndexes:   []int{},
+			wantOriginals: map[string]odlmv1alpha1.Request{"0": original},
+		},
+		{
+			name:         "request to another namespace",
+			nsMapping:    &spec.NamespaceMappings[0],
+			opreq:        newOperandRequest(nil, newRequest("other", "team-a")),
+			wantRequests: []odlmv1alpha1.Request{newRequest("other", "team-a")},
+			wantIndexes:  []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RemapRequests(tt.opreq, spec, tt.nsMapping, testDefaultCsNs)
+			if err != nil {
+				t.Fatalf("RemapRequests() error = %v", err)
+			}
+			indexes := []int{}
+			for _, r := range got {
+				indexes = append(indexes, r.Index)
+			}
+			if !reflect.DeepEqual(indexes, tt.wantIndexes) {
+				t.Errorf("RemapRequests() indexes = %v, want %v", indexes, tt.wantIndexes)
+			}
+			if !reflect.DeepEqual(tt.opreq.Spec.Requests, tt.wantRequests) {
+				t.Errorf("requests = %+v, want %+v", tt.opreq.Spec.Requests, tt.wantRequests)
+			}
+			_, ok := tt.opreq.Annotations[OriginalRequestsAnnotation]
+			if ok != (tt.wantOriginals != nil) {
+				t.Fatalf("annotation recorded = %v, want %v", ok, tt.wantOriginals != nil)
+			}
+			if tt.wantOriginals != nil && !reflect.DeepEqual(readOriginals(tt.opreq), tt.wantOriginals) {
+				t.Errorf("originals = %+v, want %+v", readOriginals(tt.opreq), tt.wantOriginals)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+// Validate returns all the errors of the namespace mappings. The namespaces
+// must be DNS-1123 labels, or patterns that are DNS-1123 labels once their
+// wildcards are replaced. The control namespace and the default Common
+// Services namespace can't be requested-from namespaces or match their
+// patterns, and the former can't be mapped to. Neither the Common Services
+// namespaces nor the requested-from namespaces can be in several mappings,
+// and a requested-from namespace can't be the Common Services namespace of
+// another mapping. A mapping needs requested-from namespaces or a namespace
+// selector, and its renamed registries and bindings must be object names
+func Validate(spec *operatorv1alpha1.CommonServiceNamespaceMappingSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.ControlNamespace != "" {
+		allErrs = append(allErrs, validateNamespace(fldPath.Child("controlNamespace"), spec.ControlNamespace)...)
+	}
+	if spec.DefaultCsNamespace != "" {
+		allErrs = append(allErrs, validateNamespace(fldPath.Child("defaultCsNamespace"), spec.DefaultCsNamespace)...)
+	}
+
+	csNamespaces := make(map[string]int)
+	for i, mapping := range spec.NamespaceMappings {
+		if _, ok := csNamespaces[mapping.MapToCommonServiceNamespace]; !ok {
+			csNamespaces[mapping.MapToCommonServiceNamespace] = i
+		}
+	}
+
+	requestedFromNamespaces := make(map[string]struct{})
+	for i, mapping := range spec.NamespaceMappings {
+		mappingPath := fldPath.Child("namespaceMappings").Index(i)
+
+		csPath := mappingPath.Child("mapToCommonServiceNamespace")
+		allErrs = append(allErrs, validateNamespace(csPath, mapping.MapToCommonServiceNamespace)...)
+		if spec.ControlNamespace != "" && spec.ControlNamespace == mapping.MapToCommonServiceNamespace {
+			allErrs = append(allErrs, field.Invalid(csPath, mapping.MapToCommonServiceNamespace, "cannot be the controlNamespace"))
+		}
+		if first := csNamespaces[mapping.MapToCommonServiceNamespace]; first != i {
+			allErrs = append(allErrs, field.Duplicate(csPath, mapping.MapToCommonServiceNamespace))
+		}
+
+		if len(mapping.RequestedFromNamespaces) == 0 && mapping.NamespaceSelector == nil {
+			allErrs = append(allErrs, field.Required(mappingPath.Child("requestedFromNamespaces"), "requestedFromNamespaces or namespaceSelector is required"))
+		}
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(mapping.NamespaceSelector, mappingPath.Child("namespaceSelector"))...)
+		if mapping.Rewrite != nil {
+			rewritePath := mappingPath.Child("rewrite")
+			allErrs = append(allErrs, validateRenames(rewritePath.Child("registries"), mapping.Rewrite.Registries)...)
+			allErrs = append(allErrs, validateRenames(rewritePath.Child("bindings"), mapping.Rewrite.Bindings)...)
+		}
+		for j, ns := range mapping.RequestedFromNamespaces {
+			nsPath := mappingPath.Child("requestedFromNamespaces").Index(j)
+			if IsPattern(ns) {
+				allErrs = append(allErrs, validatePattern(nsPath, ns)...)
+			} else {
+				allErrs = append(allErrs, validateNamespace(nsPath, ns)...)
+			}
+			if spec.ControlNamespace != "" && (spec.ControlNamespace == ns || matchPattern(ns, spec.ControlNamespace)) {
+				allErrs = append(allErrs, field.Invalid(nsPath, ns, "cannot be or match the controlNamespace"))
+			}
+			if spec.DefaultCsNamespace != "" && (spec.DefaultCsNamespace == ns || matchPattern(ns, spec.DefaultCsNamespace)) {
+				allErrs = append(allErrs, field.Invalid(nsPath, ns, "cannot be or match the default Common Services namespace"))
+			}
+			if other, ok := csNamespaces[ns]; ok && other != i {
+				allErrs = append(allErrs, field.Invalid(nsPath, ns, fmt.Sprintf("is the Common Services namespace of namespaceMappings[%d]", other)))
+			}
+			if _, ok := requestedFromNamespaces[ns]; ok {
+				allErrs = append(allErrs, field.Duplicate(nsPath, ns))
+			}
+			requestedFromNamespaces[ns] = struct{}{}
+		}
+	}
+
+	return allErrs
+}
+
+func validateNamespace(fldPath *field.Path, ns string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, msg := range validation.IsDNS1123Label(ns) {
+		allErrs = append(allErrs, field.Invalid(fldPath, ns, msg))
+	}
+	return allErrs
+}
+
+// validateRenames validates that both the names and their new names are
+// names of objects
+func validateRenames(fldPath *field.Path, renames map[string]string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := make([]string, 0, len(renames))
+	for name := range renames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(renames[name]) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(name), renames[name], msg))
+		}
+	}
+	return allErrs
+}
+
+// validatePattern validates a pattern as the namespace it would be with a
+// single character for each wildcard, so it can only match DNS-1123 labels
+func validatePattern(fldPath *field.Path, pattern string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, msg := range validation.IsDNS1123Label(strings.NewReplacer("*", "a", "?", "a").Replace(pattern)) {
+		allErrs = append(allErrs, field.Invalid(fldPath, pattern, msg))
+	}
+	return allErrs
+}
+
+// Move is a requested-from namespace mapped to another Common Services
+// namespace
+// +k8s:deepcopy-gen=false
+type Move struct {
+	Namespace string
+	From      string
+	To        string
+
+	// Path of the namespace in the new mapping
+	Path *field.Path
+}
+
+// Moves returns the requested-from namespaces of oldSpec that are mapped to
+// another Common Services namespace in newSpec. A pattern is looked up like a
+// namespace, so it's moved when it falls under a pattern of another mapping.
+// The namespace selectors aren't compared, as they depend on the labels of
+// the namespaces
+func Moves(oldSpec, newSpec *operatorv1alpha1.CommonServiceNamespaceMappingSpec, fldPath *field.Path) []Move {
+	moves := []Move{}
+	for i, mapping := range newSpec.NamespaceMappings {
+		for j, ns := range mapping.RequestedFromNamespaces {
+			oldMapping, ok := Find(oldSpec, ns, nil)
+			if !ok || oldMapping.MapToCommonServiceNamespace == mapping.MapToCommonServiceNamespace {
+				continue
+			}
+			moves = append(moves, Move{
+				Namespace: ns,
+				From:      oldMapping.MapToCommonServiceNamespace,
+				To:        mapping.MapToCommonServiceNamespace,
+				Path:      fldPath.Child("namespaceMappings").Index(i).Child("requestedFromNamespaces").Index(j),
+			})
+		}
+	}
+	return moves
+}
+
+// ValidateMoves returns an error for each requested-from namespace moved to
+// another Common Services namespace while its OperandRequests still reference
+// the previous one, as their operands would be orphaned
+func ValidateMoves(ctx context.Context, reader client.Reader, oldSpec, newSpec *operatorv1alpha1.CommonServiceNamespaceMappingSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, move := range Moves(oldSpec, newSpec, fldPath) {
+		requests, err := referencingRequests(ctx, reader, move.Namespace, move.From)
+		if err != nil {
+			allErrs = append(allErrs, field.InternalError(move.Path, err))
+			continue
+		}
+		if len(requests) > 0 {
+			allErrs = append(allErrs, field.Forbidden(move.Path, fmt.Sprintf("cannot be moved from %s to %s while the OperandRequests %s reference it",
+				move.From, move.To, strings.Join(requests, ", "))))
+		}
+	}
+	return allErrs
+}
+
+// referencingRequests returns the names of the OperandRequests of namespace
+// with a request to registryNamespace. When namespace is a pattern, the
+// OperandRequests of all the matching namespaces are returned, prefixed with
+// their namespace
+func referencingRequests(ctx context.Context, reader client.Reader, namespace, registryNamespace string) ([]string, error) {
+	list := &odlmv1alpha1.OperandRequestList{}
+	opts := []client.ListOption{}
+	if !IsPattern(namespace) {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+	if err := reader.List(ctx, list, opts...); err != nil {
+		return nil, fmt.Errorf("failed to list the OperandRequests of %s: %v", namespace, err)
+	}
+
+	names := []string{}
+	for _, opreq := range list.Items {
+		if IsPattern(namespace) && !matchPattern(namespace, opreq.Namespace) {
+			continue
+		}
+		name := opreq.Name
+		if IsPattern(namespace) {
+			name = opreq.Namespace + "/" + opreq.Name
+		}
+		for _, req := range opreq.Spec.Requests {
+			if req.RegistryNamespace == registryNamespace {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// AllowRemappingAnnotation overrides the transition rules of the mapping when
+// it's set to "true": requested-from namespaces can be removed or moved to
+// another Common Services namespace, and the mapping can be deleted
+const AllowRemappingAnnotation = "operator.ibm.com/allow-namespace-remapping"
+
+// AllowsRemapping returns whether the annotations override the transition
+// rules of the mapping
+func AllowsRemapping(annotations map[string]string) bool {
+	allowed, _ := strconv.ParseBool(annotations[AllowRemappingAnnotation])
+	return allowed
+}
+
+// ValidateTransition returns the errors of updating oldSpec to newSpec.
+// Namespaces and mappings can be added, but the requested-from namespaces of
+// oldSpec can't be removed or moved to another Common Services namespace, as
+// it would orphan the operands of the tenant
+func ValidateTransition(oldSpec, newSpec *operatorv1alpha1.CommonServiceNamespaceMappingSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	for i, mapping := range oldSpec.NamespaceMappings {
+		for j, ns := range mapping.RequestedFromNamespaces {
+			if _, ok := Find(newSpec, ns, nil); !ok {
+				nsPath := fldPath.Child("namespaceMappings").Index(i).Child("requestedFromNamespaces").Index(j)
+				allErrs = append(allErrs, field.Forbidden(nsPath, fmt.Sprintf("%s cannot be removed from the mapping to %s without the %s annotation",
+					ns, mapping.MapToCommonServiceNamespace, AllowRemappingAnnotation)))
+			}
+		}
+	}
+
+	for _, move := range Moves(oldSpec, newSpec, fldPath) {
+		allErrs = append(allErrs, field.Forbidden(move.Path, fmt.Sprintf("cannot be moved from %s to %s without the %s annotation",
+			move.From, move.To, AllowRemappingAnnotation)))
+	}
+
+	return allErrs
+}
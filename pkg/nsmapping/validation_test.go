@@ -0,0 +1,133 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     operatorv1alpha1.CommonServiceNamespaceMappingSpec
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				ControlNamespace:   "cs-control",
+				DefaultCsNamespace: "ibm-common-services",
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{RequestedFromNamespaces: []string{"team-*", "team-a-*", "app"}, MapToCommonServiceNamespace: "cs-team"},
+					{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}}, MapToCommonServiceNamespace: "cs-tenant-a"},
+				},
+			},
+		},
+		{
+			name: "pattern matching the control namespace",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				ControlNamespace: "cs-control",
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{RequestedFromNamespaces: []string{"cs-*"}, MapToCommonServiceNamespace: "tenant-cs"},
+				},
+			},
+			wantErrs: []string{"spec.namespaceMappings[0].requestedFromNamespaces[0]: Invalid value"},
+		},
+		{
+			name: "pattern matching the default Common Services namespace",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				DefaultCsNamespace: "ibm-common-services",
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{RequestedFromNamespaces: []string{"ibm-*"}, MapToCommonServiceNamespace: "cs-ibm"},
+				},
+			},
+			wantErrs: []string{"spec.namespaceMappings[0].requestedFromNamespaces[0]: Invalid value"},
+		},
+		{
+			name: "invalid pattern",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{RequestedFromNamespaces: []string{"Team-*"}, MapToCommonServiceNamespace: "cs-team"},
+				},
+			},
+			wantErrs: []string{"spec.namespaceMappings[0].requestedFromNamespaces[0]: Invalid value"},
+		},
+		{
+			name: "duplicate namespaces",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{RequestedFromNamespaces: []string{"team-*"}, MapToCommonServiceNamespace: "cs-team"},
+					{RequestedFromNamespaces: []string{"team-*"}, MapToCommonServiceNamespace: "cs-team"},
+				},
+			},
+			wantErrs: []string{
+				"spec.namespaceMappings[1].mapToCommonServiceNamespace: Duplicate value",
+				"spec.namespaceMappings[1].requestedFromNamespaces[0]: Duplicate value",
+			},
+		},
+		{
+			name: "requested-from namespace of another mapping",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{RequestedFromNamespaces: []string{"app"}, MapToCommonServiceNamespace: "cs-app"},
+					{RequestedFromNamespaces: []string{"cs-app"}, MapToCommonServiceNamespace: "cs-other"},
+				},
+			},
+			wantErrs: []string{"spec.namespaceMappings[1].requestedFromNamespaces[0]: Invalid value"},
+		},
+		{
+			name: "mapping without namespaces nor selector",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{MapToCommonServiceNamespace: "cs-team"},
+				},
+			},
+			wantErrs: []string{"spec.namespaceMappings[0].requestedFromNamespaces: Required value"},
+		},
+		{
+			name: "mapping to the control namespace",
+			spec: operatorv1alpha1.CommonServiceNamespaceMappingSpec{
+				ControlNamespace: "cs-control",
+				NamespaceMappings: []operatorv1alpha1.NamespaceMapping{
+					{RequestedFromNamespaces: []string{"app"}, MapToCommonServiceNamespace: "cs-control"},
+				},
+			},
+			wantErrs: []string{"spec.namespaceMappings[0].mapToCommonServiceNamespace: Invalid value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := []string{}
+			for _, err := range Validate(&tt.spec, field.NewPath("spec")) {
+				errs = append(errs, err.Field+": "+err.Type.String())
+			}
+			if len(tt.wantErrs) == 0 {
+				tt.wantErrs = []string{}
+			}
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("Validate() = %v, want %v", errs, tt.wantErrs)
+			}
+		})
+	}
+}
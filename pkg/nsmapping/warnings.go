@@ -0,0 +1,148 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nsmapping
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	odlmv1alpha1 "github.com/IBM/operand-deployment-lifecycle-manager/api/v1alpha1"
+
+	operatorv1alpha1 "github.com/IBM/ibm-common-service-webhook/pkg/apis/v1alpha1"
+)
+
+// Warnings cross-checks the mapping against the cluster. It returns a warning
+// for each Common Services namespace that doesn't exist, each requested-from
+// namespace without OperandRequests, each namespace selected by several
+// mappings or whose selection has no effect, and each OperandRequest with a
+// request to another Common Services namespace than the mapped one or the
+// default one. They don't deny the mapping, as namespaces and OperandRequests
+// may be created after it
+func Warnings(ctx context.Context, reader client.Reader, spec *operatorv1alpha1.CommonServiceNamespaceMappingSpec) ([]string, error) {
+	warnings := []string{}
+
+	nsList := &corev1.NamespaceList{}
+	if err := reader.List(ctx, nsList); err != nil {
+		return nil, fmt.Errorf("failed to list the namespaces: %v", err)
+	}
+	nsLabels := make(map[string]map[string]string)
+	for _, ns := range nsList.Items {
+		nsLabels[ns.Name] = ns.Labels
+		if nsLabels[ns.Name] == nil {
+			nsLabels[ns.Name] = map[string]string{}
+		}
+	}
+
+	for _, mapping := range spec.NamespaceMappings {
+		if _, ok := nsLabels[mapping.MapToCommonServiceNamespace]; !ok {
+			warnings = append(warnings, fmt.Sprintf("the Common Services namespace %s does not exist", mapping.MapToCommonServiceNamespace))
+		}
+	}
+
+	if HasSelectors(spec) {
+		for _, ns := range nsList.Items {
+			warnings = append(warnings, selectorWarnings(spec, ns.Name, nsLabels[ns.Name])...)
+		}
+	}
+
+	list := &odlmv1alpha1.OperandRequestList{}
+	if err := reader.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("failed to list the OperandRequests: %v", err)
+	}
+	requests := make(map[string][]odlmv1alpha1.OperandRequest)
+	for _, opreq := range list.Items {
+		requests[opreq.Namespace] = append(requests[opreq.Namespace], opreq)
+	}
+
+	for _, mapping := range spec.NamespaceMappings {
+		for _, ns := range mapping.RequestedFromNamespaces {
+			if !IsPattern(ns) && len(requests[ns]) == 0 {
+				warnings = append(warnings, fmt.Sprintf("the requested-from namespace %s has no OperandRequests", ns))
+			}
+		}
+	}
+
+	namespaces := make([]string, 0, len(requests))
+	for ns := range requests {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		mapping, ok := Find(spec, ns, nsLabels[ns])
+		if !ok || mapping.MapToCommonServiceNamespace == ns {
+			continue
+		}
+
+		mismatched := []string{}
+		for _, opreq := range requests[ns] {
+			for _, req := range opreq.Spec.Requests {
+				if req.RegistryNamespace != "" && req.RegistryNamespace != mapping.MapToCommonServiceNamespace && req.RegistryNamespace != spec.DefaultCsNamespace {
+					mismatched = append(mismatched, fmt.Sprintf("%s (%s)", opreq.Name, req.RegistryNamespace))
+					break
+				}
+			}
+		}
+		if len(mismatched) > 0 {
+			sort.Strings(mismatched)
+			warnings = append(warnings, fmt.Sprintf("the OperandRequests %s of %s have a registryNamespace other than %s",
+				strings.Join(mismatched, ", "), ns, mapping.MapToCommonServiceNamespace))
+		}
+	}
+
+	return warnings, nil
+}
+
+// selectorWarnings returns the warnings of the namespace selectors matching
+// the namespace. Only the first selector is used when several match, and the
+// control namespace and the default Common Services namespace shouldn't be
+// mapped
+func selectorWarnings(spec *operatorv1alpha1.CommonServiceNamespaceMappingSpec, namespace string, nsLabels map[string]string) []string {
+	selected := []string{}
+	for _, mapping := range spec.NamespaceMappings {
+		if mapping.NamespaceSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(mapping.NamespaceSelector)
+		if err == nil && selector.Matches(labels.Set(nsLabels)) {
+			selected = append(selected, mapping.MapToCommonServiceNamespace)
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	switch namespace {
+	case spec.ControlNamespace:
+		return []string{fmt.Sprintf("the controlNamespace %s is selected by the mapping to %s", namespace, selected[0])}
+	case spec.DefaultCsNamespace:
+		return []string{fmt.Sprintf("the default Common Services namespace %s is selected by the mapping to %s", namespace, selected[0])}
+	}
+	if len(selected) > 1 {
+		if mapping, _ := Find(spec, namespace, nil); mapping.MapToCommonServiceNamespace == "" {
+			return []string{fmt.Sprintf("the namespace %s is selected by the mappings to %s, only the first one is used",
+				namespace, strings.Join(selected, ", "))}
+		}
+	}
+	return nil
+}
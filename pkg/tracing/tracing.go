@@ -0,0 +1,166 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tracing sets up the OpenTelemetry tracing of the admission requests.
+// Tracing is disabled by default, in which case the spans are no-ops.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/metrics"
+	"github.com/IBM/ibm-common-service-webhook/version"
+)
+
+const tracerName = "github.com/IBM/ibm-common-service-webhook"
+
+// Exporters supported by Setup
+const (
+	// ExporterNone disables tracing
+	ExporterNone = "none"
+	// ExporterOTLP exports the spans over OTLP/HTTP to the endpoint set with
+	// the standard OTEL_EXPORTER_OTLP_* environment variables
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes the spans to stdout
+	ExporterStdout = "stdout"
+	// ExporterFile writes the spans to a file, for local testing
+	ExporterFile = "file"
+)
+
+// Setup installs the global TracerProvider for the given exporter. It returns
+// a function that flushes the pending spans and stops the exporter
+func Setup(ctx context.Context, exporter, file string) (func(context.Context) error, error) {
+	var (
+		spanExporter sdktrace.SpanExporter
+		closer       io.Closer
+		err          error
+	)
+
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if file == "" {
+			return nil, fmt.Errorf("a file is required for the %s traces exporter", ExporterFile)
+		}
+		var f *os.File
+		f, err = os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		closer = f
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("unsupported traces exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("ibm-common-service-webhook"),
+			semconv.ServiceVersionKey.String(version.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// StartSpan starts a span as a child of the span in ctx, if any
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err, if any, in span and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracedHandler creates a span covering every admission request handled by
+// Handler, which is the parent of the spans started by the handler
+// +k8s:deepcopy-gen=false
+type TracedHandler struct {
+	Name    string
+	Handler admission.Handler
+}
+
+// Handle calls the wrapped handler within the admission request span
+func (h *TracedHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, span := StartSpan(ctx, h.Name,
+		attribute.String("admission.uid", string(req.UID)),
+		attribute.String("admission.kind", req.Kind.Kind),
+		attribute.String("admission.namespace", req.Namespace),
+		attribute.String("admission.name", req.Name),
+		attribute.String("admission.operation", string(req.Operation)),
+	)
+	defer span.End()
+
+	resp := h.Handler.Handle(ctx, req)
+
+	result := metrics.ResultOf(resp)
+	span.SetAttributes(attribute.String("admission.result", result))
+	if result == metrics.ResultErrored {
+		span.SetStatus(codes.Error, resp.Result.Message)
+	}
+
+	return resp
+}
+
+// InjectDecoder injects the decoder into the wrapped handler
+func (h *TracedHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
+// InjectFunc injects the dependencies into the wrapped handler
+func (h *TracedHandler) InjectFunc(f inject.Func) error {
+	return f(h.Handler)
+}
@@ -18,22 +18,100 @@ package utils
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
-// GetWatchNamespace returns the Namespace of the operator
+// GetWatchNamespace returns the namespaces watched by the operator, as set in
+// WATCH_NAMESPACE. It's a comma-separated list, empty to watch all namespaces
 func GetWatchNamespace() string {
 	ns, _ := os.LookupEnv("WATCH_NAMESPACE")
 	return ns
 }
 
-// GetEnableOpreqWebhook check if enable the webhook for the OperandRequest
+// GetWatchNamespaces returns the list of namespaces in WATCH_NAMESPACE, nil to
+// watch all namespaces
+func GetWatchNamespaces() []string {
+	return SplitNamespaces(GetWatchNamespace())
+}
+
+// SplitNamespaces splits a comma-separated list of namespaces, skipping the
+// empty ones
+func SplitNamespaces(list string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(list, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// GetOperatorNamespace returns the namespace the operator runs in, where the
+// webhook Service, CA ConfigMap and certificates Secret are created. It's set
+// in OPERATOR_NAMESPACE, and defaults to WATCH_NAMESPACE when it's a single
+// namespace
+func GetOperatorNamespace() string {
+	if ns := strings.TrimSpace(os.Getenv("OPERATOR_NAMESPACE")); ns != "" {
+		return ns
+	}
+	if namespaces := GetWatchNamespaces(); len(namespaces) == 1 {
+		return namespaces[0]
+	}
+	return ""
+}
+
+// GetEnableOpreqWebhook check if enable the webhook for the OperandRequest.
+// ENABLE_OPREQ_WEBHOOK accepts any boolean value, case insensitive
 func GetEnableOpreqWebhook() bool {
-	enable, ok := os.LookupEnv("ENABLE_OPREQ_WEBHOOK")
-	if !ok {
-		return false
+	enable, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("ENABLE_OPREQ_WEBHOOK")))
+	return enable
+}
+
+// GetNsMappingFailurePolicy returns the failure policy of the namespace mapping
+// validating webhook set in NS_MAPPING_FAILURE_POLICY, "Ignore" or "Fail" case
+// insensitive, and "Fail" when it isn't set. Other values are returned as is,
+// so the validation of the configuration rejects them
+func GetNsMappingFailurePolicy() string {
+	policy := strings.TrimSpace(os.Getenv("NS_MAPPING_FAILURE_POLICY"))
+	switch {
+	case policy == "", strings.EqualFold(policy, "Fail"):
+		return "Fail"
+	case strings.EqualFold(policy, "Ignore"):
+		return "Ignore"
+	default:
+		return policy
 	}
-	if enable != "TRUE" {
-		return false
+}
+
+// GetTracesExporter returns the exporter of the admission traces set in
+// OTEL_TRACES_EXPORTER, "none" if it's not set
+func GetTracesExporter() string {
+	exporter, ok := os.LookupEnv("OTEL_TRACES_EXPORTER")
+	if !ok || exporter == "" {
+		return "none"
+	}
+	return strings.ToLower(exporter)
+}
+
+// GetTracesFile returns the file the "file" traces exporter writes to
+func GetTracesFile() string {
+	file, _ := os.LookupEnv("OTEL_TRACES_FILE")
+	return file
+}
+
+// GetAuditTrailSize returns the number of mutations kept in the audit trail set
+// in AUDIT_TRAIL_SIZE, 0 to use the default size
+func GetAuditTrailSize() int {
+	size, err := strconv.Atoi(os.Getenv("AUDIT_TRAIL_SIZE"))
+	if err != nil {
+		return 0
 	}
-	return true
+	return size
+}
+
+// GetAuditLogEnabled check if the audit records are mirrored as log lines
+func GetAuditLogEnabled() bool {
+	enable, _ := strconv.ParseBool(os.Getenv("AUDIT_LOG"))
+	return enable
 }
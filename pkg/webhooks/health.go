@@ -0,0 +1,80 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhooks
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const healthCheckTimeout = time.Second * 2
+
+// CertsChecker checks that the certificates extracted by setupCerts exist in
+// webhookConfig.CertDir and can be parsed as a key pair
+func (webhookConfig *CSWebhookConfig) CertsChecker() healthz.Checker {
+	return func(_ *http.Request) error {
+		_, err := tls.LoadX509KeyPair(
+			filepath.Join(webhookConfig.CertDir, "tls.crt"),
+			filepath.Join(webhookConfig.CertDir, "tls.key"),
+		)
+		if err != nil {
+			return fmt.Errorf("webhook certificates are not ready: %v", err)
+		}
+		return nil
+	}
+}
+
+// ServerChecker checks that the webhook server is listening on webhookConfig.Port
+func (webhookConfig *CSWebhookConfig) ServerChecker() healthz.Checker {
+	return func(_ *http.Request) error {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", webhookConfig.Port), healthCheckTimeout)
+		if err != nil {
+			return fmt.Errorf("webhook server is not listening: %v", err)
+		}
+		return conn.Close()
+	}
+}
+
+// CacheSyncChecker checks that the informers of the given objects, which are
+// read by the webhook handlers, have synced. The informers are created on the
+// first check, so replicas that aren't the leader warm them up as well
+func CacheSyncChecker(informers cache.Cache, objects ...k8sclient.Object) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), healthCheckTimeout)
+		defer cancel()
+
+		for _, object := range objects {
+			if _, err := informers.GetInformer(ctx, object); err != nil {
+				return fmt.Errorf("failed to get informer: %v", err)
+			}
+		}
+
+		if !informers.WaitForCacheSync(ctx) {
+			return fmt.Errorf("cache has not synced")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhooks
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/metrics"
+)
+
+var log = logf.Log.WithName("webhooks")
+
+// LoggingHandler adds a logger correlated to the admission request into the
+// context passed to Handler, which can be retrieved with logf.FromContext
+// +k8s:deepcopy-gen=false
+type LoggingHandler struct {
+	Name    string
+	Handler admission.Handler
+}
+
+// Handle calls the wrapped handler with the request-scoped logger
+func (h *LoggingHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := log.WithName(h.Name).WithValues(
+		"uid", req.UID,
+		"kind", req.Kind.Kind,
+		"namespace", req.Namespace,
+		"name", req.Name,
+		"operation", req.Operation,
+	)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		logger = logger.WithValues("traceID", spanContext.TraceID().String())
+	}
+
+	logger.V(1).Info("Handling admission request")
+	resp := h.Handler.Handle(logf.IntoContext(ctx, logger), req)
+	logger.V(1).Info("Handled admission request", "result", metrics.ResultOf(resp))
+
+	return resp
+}
+
+// InjectDecoder injects the decoder into the wrapped handler
+func (h *LoggingHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
+// InjectFunc injects the dependencies into the wrapped handler
+func (h *LoggingHandler) InjectFunc(f inject.Func) error {
+	return f(h.Handler)
+}
@@ -18,43 +18,103 @@ package webhooks
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/operator-framework/operator-lifecycle-manager/pkg/lib/ownerutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
-	"github.com/IBM/ibm-common-service-webhook/pkg/utils"
+	"github.com/IBM/ibm-common-service-webhook/pkg/audit"
 )
 
 // CSWebhookConfig contains the data and logic to setup the webhooks
 // server of a given Manager implementation, and to reconcile webhook configuration
 // CRs pointing to the server.
+// It's built with NewCSWebhookConfig, and the same instance must be used to
+// setup the server at startup and to reconcile the webhook configurations.
+// +k8s:deepcopy-gen=false
 type CSWebhookConfig struct {
 	scheme *runtime.Scheme
 
-	Port        int
-	CertDir     string
+	// Namespace of the Service, the CA ConfigMap and the certificates Secret
+	Namespace string
+
+	// ServiceName of the Service that exposes the webhook server
+	ServiceName string
+
+	// Port that the webhook server listens on, and the Service points to
+	Port int
+
+	// ServicePort that the Service exposes, used by the webhook configurations
+	ServicePort int
+
+	// CertProvider of the webhook server certificates, CertProviderServiceCA
+	// or CertProviderManual
+	CertProvider string
+
+	// CertDir where the certificates of the webhook server are saved
+	CertDir string
+
+	// CertSecretName of the Secret generated with the Service certificates
+	CertSecretName string
+
+	// CAConfigMap where the CA certificate is injected
 	CAConfigMap string
 
+	// Labels set on the webhook configurations, used to find and prune them,
+	// and on the namespaces served by the pod webhook. They default to a label
+	// derived from ConfigurationSuffix, so instances sharing a cluster have
+	// different labels
+	Labels map[string]string
+
+	// PodSelector of the Service, matching the operator pods. It's a single
+	// label, derived from ServiceName by default
+	PodSelector map[string]string
+
+	// ConfigurationSuffix is appended to the name of the webhook configurations,
+	// so instances sharing a cluster don't overwrite each other's
+	ConfigurationSuffix string
+
+	// PruneDynamicWebhooks prunes the configurations labeled with
+	// DynamicWebhookLabel, when the controller reconciling them is disabled
+	PruneDynamicWebhooks bool
+
 	Webhooks []CSWebhook
+
+	// switches is the runtime state of the webhooks by Switch, guarded by
+	// switchesMu
+	switchesMu sync.RWMutex
+	switches   map[string]bool
+
+	// reconcileMu serializes the reconciles of the controllers and of the
+	// SwitchesWatcher
+	reconcileMu sync.Mutex
 }
 
 // CSWebhook acts as a single source of truth for validating webhooks
 // managed by the operator. It's data are used both for registering the
 // endpoint to the webhook server and to reconcile the ValidatingWebhookConfiguration
 // that points to the server.
+// Several CSWebhooks with the same Name and different WebhookName are reconciled
+// as multiple webhooks of the same configuration.
 type CSWebhook struct {
 	// Name of the webhookConfiguration.
 	Name string
@@ -65,44 +125,59 @@ type CSWebhook struct {
 	// Rule for the webhook to be triggered
 	Rule RuleWithOperations
 
+	// Rules for the webhook to be triggered, in addition to Rule
+	Rules []RuleWithOperations
+
 	// Register for the webhook into the server
 	Register WebhookRegister
 
+	// Switch is the key that enables and disables the webhook at runtime, see
+	// SetSwitches. The webhook is always enabled when it's empty
+	Switch string
+
+	// Disabled is the state of the webhook until it's switched on
+	Disabled bool
+
 	// NsSelector for add namespaceselector to the admission webhook
 	NsSelector v1.LabelSelector
-}
 
-const (
-	operatorPodServiceName = "ibm-common-service-webhook"
-	operatorPodPort        = 8443
-	servicePort            = 443
-	mountedCertDir         = "/etc/ssl/certs/webhook"
-	caConfigMap            = "ibm-cs-operator-webhook-ca"
-	caConfigMapAnnotation  = "service.beta.openshift.io/inject-cabundle"
-	caServiceAnnotation    = "service.beta.openshift.io/serving-cert-secret-name"
-)
+	// ObjectSelector for add objectselector to the admission webhook
+	ObjectSelector v1.LabelSelector
+
+	// FailurePolicy of the webhook. Defaults to Ignore for mutating webhooks
+	// and Fail for validating webhooks
+	FailurePolicy *admissionregistrationv1.FailurePolicyType
 
-// Config is a global instance. The same instance is needed in order to use the
-// same configuration for the webhooks server that's run at startup and the
-// reconciliation of the ValidatingWebhookConfiguration CRs
-var Config *CSWebhookConfig = &CSWebhookConfig{
-	// Port that the webhook service is pointing to
-	Port: operatorPodPort,
+	// TimeoutSeconds of the webhook. Defaults to 10
+	TimeoutSeconds *int32
 
-	// Mounted as a volume from the secret generated from Openshift
-	CertDir: mountedCertDir,
+	// SideEffects of the webhook. Defaults to None
+	SideEffects *admissionregistrationv1.SideEffectClass
 
-	// Name of the config map where the CA certificate is injected
-	CAConfigMap: caConfigMap,
+	// MatchPolicy of the webhook. Defaults to Exact
+	MatchPolicy *admissionregistrationv1.MatchPolicyType
 
-	// List of webhooks to configure
-	Webhooks: []CSWebhook{},
+	// ReinvocationPolicy of the webhook. Only used by mutating webhooks,
+	// defaults to Never
+	ReinvocationPolicy *admissionregistrationv1.ReinvocationPolicyType
 }
 
+const (
+	caConfigMapAnnotation = "service.beta.openshift.io/inject-cabundle"
+	caServiceAnnotation   = "service.beta.openshift.io/serving-cert-secret-name"
+	fieldManager          = "ibm-common-service-webhook"
+)
+
+// DynamicWebhookLabel marks the webhook configurations reconciled at runtime
+// out of webhookConfig.Webhooks, e.g. for a MutationPolicy. They are not
+// pruned with the registered ones, but garbage collected with their owner,
+// unless PruneDynamicWebhooks is set
+const DynamicWebhookLabel = "operator.ibm.com/dynamic-webhook"
+
 // SetupServer sets up the webhook server managed by mgr with the settings from
 // webhookConfig. It sets the port and cert dir based on the settings and
 // registers the Validator implementations from each webhook from webhookConfig.Webhooks
-func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager, namespace string) error {
+func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager) error {
 	// Create a new client to reconcile the Service. `mgr.GetClient()` can't
 	// be used as it relies on the cache that hasn't been initialized yet
 	client, err := k8sclient.New(mgr.GetConfig(), k8sclient.Options{
@@ -113,12 +188,15 @@ func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager, namespace
 	}
 
 	// Create the service pointing to the operator pod
-	if err := webhookConfig.ReconcileService(context.TODO(), client, nil, namespace); err != nil {
+	if err := webhookConfig.ReconcileService(context.TODO(), client, nil); err != nil {
 		return err
 	}
-	// Get the secret with the certificates for the service
-	if err := webhookConfig.setupCerts(context.TODO(), client, namespace); err != nil {
-		return err
+	// Get the secret with the certificates for the service. The manual
+	// provider mounts them in the cert dir
+	if webhookConfig.CertProvider == CertProviderServiceCA {
+		if err := webhookConfig.setupCerts(context.TODO(), client); err != nil {
+			return err
+		}
 	}
 
 	webhookServer := mgr.GetWebhookServer()
@@ -130,69 +208,328 @@ func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager, namespace
 	bldr := builder.WebhookManagedBy(mgr)
 
 	for _, webhook := range webhookConfig.Webhooks {
+		// Every switchable webhook is served, and allows the admission
+		// requests while it's disabled
+		if awr, ok := webhook.Register.(AdmissionWebhookRegister); ok && webhook.Switch != "" {
+			webhook := webhook
+			awr.Hook.Handler = &SwitchedHandler{
+				Enabled: func() bool { return webhookConfig.IsEnabled(webhook) },
+				Handler: awr.Hook.Handler,
+			}
+		}
 		bldr = webhook.Register.RegisterToBuilder(bldr)
 		webhook.Register.RegisterToServer(webhookConfig.scheme, webhookServer)
 	}
 
 	bldr.Complete()
 
+	// Serve the audit trail of the mutations applied by the webhooks
+	webhookServer.Register(audit.Path, &audit.HTTPHandler{
+		Client: client,
+		Trail:  audit.DefaultTrail,
+	})
+
 	return nil
 }
 
 // Reconcile reconciles a `ValidationWebhookConfiguration` object for each webhook
 // in `webhookConfig.Webhooks`, using the rules and the path as it's generated
 // by controller-runtime webhook builder.
-// It reconciles a Service that exposes the webhook server
+// It reconciles a Service that exposes the webhook server, and deletes the
+// labeled webhook configurations that are no longer registered or that are
+// switched off
 // A ownerRef to the owner parameter is set on the reconciled resources. This
 // parameter is optional, if `nil` is passed, no ownerReference will be set
 func (webhookConfig *CSWebhookConfig) Reconcile(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner) error {
+	logger := logf.FromContext(ctx)
 
-	namespace := utils.GetWatchNamespace()
+	webhookConfig.reconcileMu.Lock()
+	defer webhookConfig.reconcileMu.Unlock()
 
 	// Reconcile the Service
-	if err := webhookConfig.ReconcileService(ctx, client, owner, namespace); err != nil {
+	if err := webhookConfig.ReconcileService(ctx, client, owner); err != nil {
+		return err
+	}
+
+	caBundle, err := webhookConfig.CABundle(ctx, client)
+	if err != nil {
 		return err
 	}
 
+	// Reconcile the enabled webhooks
+	for _, webhook := range webhookConfig.Webhooks {
+		if !webhookConfig.IsEnabled(webhook) {
+			logger.Info("Skipping disabled webhook", "configuration", webhookConfig.ConfigurationName(webhook.Name), "webhook", webhook.WebhookName)
+			continue
+		}
+		reconciler, err := webhook.Register.GetReconciler(webhookConfig.scheme)
+		if err != nil {
+			return err
+		}
+
+		reconciler.SetName(webhookConfig.ConfigurationName(webhook.Name))
+		reconciler.SetWebhookName(webhook.WebhookName)
+		reconciler.SetRules(webhook.GetRules())
+		reconciler.SetNsSelector(webhook.NsSelector)
+		reconciler.SetObjectSelector(webhook.ObjectSelector)
+		reconciler.SetFailurePolicy(webhook.FailurePolicy)
+		reconciler.SetTimeoutSeconds(webhook.TimeoutSeconds)
+		reconciler.SetSideEffects(webhook.SideEffects)
+		reconciler.SetMatchPolicy(webhook.MatchPolicy)
+		reconciler.SetReinvocationPolicy(webhook.ReinvocationPolicy)
+		reconciler.SetService(webhookConfig.Namespace, webhookConfig.ServiceName, int32(webhookConfig.ServicePort))
+		reconciler.SetLabels(webhookConfig.Labels)
+		logger.Info("Reconciling webhook", "configuration", webhookConfig.ConfigurationName(webhook.Name), "webhook", webhook.WebhookName)
+		if err := reconciler.Reconcile(ctx, client, caBundle); err != nil {
+			return err
+		}
+	}
+
+	// Delete the webhook configurations that are no longer registered
+	return webhookConfig.pruneWebhookConfigurations(ctx, client)
+}
+
+// CABundle returns the CA certificate of the webhook server. With the
+// service-ca provider, it's injected in the CA ConfigMap, which is created if
+// it doesn't exist
+func (webhookConfig *CSWebhookConfig) CABundle(ctx context.Context, client k8sclient.Client) ([]byte, error) {
+	logger := logf.FromContext(ctx)
+
+	if webhookConfig.CertProvider == CertProviderManual {
+		caBundle, err := ioutil.ReadFile(filepath.Join(webhookConfig.CertDir, "ca.crt"))
+		if err != nil {
+			logger.Error(err, "Failed to read the common service webhook CA", "CertDir", webhookConfig.CertDir)
+		}
+		return caBundle, err
+	}
+
 	// Create (if it doesn't exist) the config map where the CA certificate is
 	// injected
 	caConfigMap := &corev1.ConfigMap{
 		ObjectMeta: v1.ObjectMeta{
 			Name:      webhookConfig.CAConfigMap,
-			Namespace: namespace,
+			Namespace: webhookConfig.Namespace,
 			Annotations: map[string]string{
 				caConfigMapAnnotation: "true",
 			},
 		},
 	}
 
-	klog.Info("Creating common service webhook CA ConfigMap")
+	logger.Info("Creating common service webhook CA ConfigMap", "ConfigMap", webhookConfig.CAConfigMap)
 	err := client.Create(ctx, caConfigMap)
 	if err != nil && !errors.IsAlreadyExists(err) {
-		klog.Error(err)
-		return err
+		logger.Error(err, "Failed to create common service webhook CA ConfigMap")
+		return nil, err
 	}
 
 	// Wait for the config map to be injected with the CA
-	caBundle, err := webhookConfig.waitForCAInConfigMap(ctx, client, namespace)
+	caBundle, err := webhookConfig.waitForCAInConfigMap(ctx, client)
+	if err != nil {
+		logger.Error(err, "Failed to get the CA from the common service webhook CA ConfigMap")
+	}
+	return caBundle, err
+}
+
+// ConfigurationName returns the name of the given webhook configuration for
+// this instance
+func (webhookConfig *CSWebhookConfig) ConfigurationName(name string) string {
+	if webhookConfig.ConfigurationSuffix == "" {
+		return name
+	}
+	return fmt.Sprintf("%s-%s", name, webhookConfig.ConfigurationSuffix)
+}
+
+// OwnPodsExclusion returns the requirements of an object selector that
+// exclude the operator pods. PodSelector has a single label, as checked by
+// Options.Validate, so only the pods matching the whole selector are excluded
+func (webhookConfig *CSWebhookConfig) OwnPodsExclusion() []v1.LabelSelectorRequirement {
+	requirements := []v1.LabelSelectorRequirement{}
+	for key, value := range webhookConfig.PodSelector {
+		requirements = append(requirements, v1.LabelSelectorRequirement{
+			Key:      key,
+			Operator: v1.LabelSelectorOpNotIn,
+			Values:   []string{value},
+		})
+	}
+	return requirements
+}
+
+// ownsConfiguration returns whether the webhook configuration name has the
+// suffix of this instance, so the configurations of other instances are never
+// pruned, even if they have the same labels
+func (webhookConfig *CSWebhookConfig) ownsConfiguration(name string) bool {
+	if webhookConfig.ConfigurationSuffix == "" {
+		return true
+	}
+	return strings.HasSuffix(name, "-"+webhookConfig.ConfigurationSuffix)
+}
+
+// isDynamic returns whether the webhook configuration with these labels is
+// reconciled at runtime by another controller, which the pruner must skip
+func (webhookConfig *CSWebhookConfig) isDynamic(labels map[string]string) bool {
+	_, ok := labels[DynamicWebhookLabel]
+	return ok && !webhookConfig.PruneDynamicWebhooks
+}
+
+// Names of the webhook configurations created before they were labeled. They
+// are pruned along with the labeled ones, so a configuration whose webhook is
+// already disabled at upgrade isn't left behind. They have no suffix, so only
+// an instance without ConfigurationSuffix owns them
+var (
+	legacyMutatingConfigurations   = []string{"ibm-common-service-webhook-configuration", "ibm-operandrequest-webhook-configuration"}
+	legacyValidatingConfigurations = []string{"ibm-cs-ns-mapping-webhook-configuration"}
+)
+
+// getLegacyConfiguration gets the legacy webhook configuration name into obj.
+// It returns false when this instance doesn't own the legacy configurations,
+// when it doesn't exist, or when it's labeled and so already listed
+func (webhookConfig *CSWebhookConfig) getLegacyConfiguration(ctx context.Context, client k8sclient.Client, name string, obj k8sclient.Object) (bool, error) {
+	if webhookConfig.ConfigurationSuffix != "" {
+		return false, nil
+	}
+	if err := client.Get(ctx, k8sclient.ObjectKey{Name: name}, obj); err != nil {
+		return false, k8sclient.IgnoreNotFound(err)
+	}
+	for key, value := range webhookConfig.Labels {
+		if obj.GetLabels()[key] != value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// removeWebhooks removes the webhooks of cr missing from registered, names
+// being the names of its webhooks in order. They are removed with a JSON patch
+// instead of an update, so the field managers of the remaining webhooks stay
+// their only owners. Each removal is guarded by a test of the webhook name, so
+// the patch fails instead of removing another webhook if the configuration
+// changed since it was read
+func removeWebhooks(ctx context.Context, client k8sclient.Client, cr k8sclient.Object, names []string, registered map[string]struct{}) error {
+	ops := []map[string]interface{}{}
+	removed := []string{}
+	// The webhooks are removed from the last one, so the indexes of the
+	// following removals don't shift
+	for i := len(names) - 1; i >= 0; i-- {
+		if _, ok := registered[names[i]]; ok {
+			continue
+		}
+		path := fmt.Sprintf("/webhooks/%d", i)
+		ops = append(ops,
+			map[string]interface{}{"op": "test", "path": path + "/name", "value": names[i]},
+			map[string]interface{}{"op": "remove", "path": path})
+		removed = append(removed, names[i])
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(ops)
 	if err != nil {
-		klog.Error(err)
 		return err
 	}
+	logf.FromContext(ctx).Info("Removing unregistered webhooks", "configuration", cr.GetName(), "webhooks", removed)
+	return client.Patch(ctx, cr, k8sclient.RawPatch(types.JSONPatchType, data), k8sclient.FieldOwner(fieldManager))
+}
 
-	// Reconcile the webhooks
+// pruneWebhookConfigurations deletes the webhook configurations labeled as
+// managed by this instance, or with a legacy name, whose name is not in
+// `webhookConfig.Webhooks`, e.g. after ENABLE_OPREQ_WEBHOOK has been switched
+// off, or whose webhooks are all disabled. From the remaining ones, it removes
+// the webhooks that are no longer registered or enabled.
+func (webhookConfig *CSWebhookConfig) pruneWebhookConfigurations(ctx context.Context, client k8sclient.Client) error {
+	logger := logf.FromContext(ctx)
+
+	registered := make(map[string]map[string]struct{})
 	for _, webhook := range webhookConfig.Webhooks {
-		reconciler, err := webhook.Register.GetReconciler(webhookConfig.scheme)
+		if !webhookConfig.IsEnabled(webhook) {
+			continue
+		}
+		name := webhookConfig.ConfigurationName(webhook.Name)
+		if _, ok := registered[name]; !ok {
+			registered[name] = make(map[string]struct{})
+		}
+		registered[name][webhook.WebhookName] = struct{}{}
+	}
+
+	managedLabels := k8sclient.MatchingLabels(webhookConfig.Labels)
+
+	mutatingList := &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	if err := client.List(ctx, mutatingList, managedLabels); err != nil {
+		logger.Error(err, "Failed to list MutatingWebhookConfigurations")
+		return err
+	}
+	for _, name := range legacyMutatingConfigurations {
+		cr := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		legacy, err := webhookConfig.getLegacyConfiguration(ctx, client, name, cr)
 		if err != nil {
+			logger.Error(err, "Failed to get MutatingWebhookConfiguration", "MutatingWebhookConfiguration", name)
 			return err
 		}
+		if legacy {
+			mutatingList.Items = append(mutatingList.Items, *cr)
+		}
+	}
+	for i := range mutatingList.Items {
+		cr := &mutatingList.Items[i]
+		if webhookConfig.isDynamic(cr.Labels) || !webhookConfig.ownsConfiguration(cr.Name) {
+			continue
+		}
+		webhookNames, ok := registered[cr.Name]
+		if !ok {
+			logger.Info("Deleting MutatingWebhookConfiguration as it's no longer registered", "MutatingWebhookConfiguration", cr.Name)
+			if err := client.Delete(ctx, cr); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete MutatingWebhookConfiguration", "MutatingWebhookConfiguration", cr.Name)
+				return err
+			}
+			continue
+		}
 
-		reconciler.SetName(webhook.Name)
-		reconciler.SetWebhookName(webhook.WebhookName)
-		reconciler.SetRule(webhook.Rule)
-		reconciler.SetNsSelector(webhook.NsSelector)
-		klog.Infof("Reconciling webhook %s", webhook.Name)
-		if err := reconciler.Reconcile(ctx, client, caBundle); err != nil {
+		names := make([]string, 0, len(cr.Webhooks))
+		for _, webhook := range cr.Webhooks {
+			names = append(names, webhook.Name)
+		}
+		if err := removeWebhooks(ctx, client, cr, names, webhookNames); err != nil {
+			logger.Error(err, "Failed to remove unregistered webhooks", "MutatingWebhookConfiguration", cr.Name)
+			return err
+		}
+	}
+
+	validatingList := &admissionregistrationv1.ValidatingWebhookConfigurationList{}
+	if err := client.List(ctx, validatingList, managedLabels); err != nil {
+		logger.Error(err, "Failed to list ValidatingWebhookConfigurations")
+		return err
+	}
+	for _, name := range legacyValidatingConfigurations {
+		cr := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		legacy, err := webhookConfig.getLegacyConfiguration(ctx, client, name, cr)
+		if err != nil {
+			logger.Error(err, "Failed to get ValidatingWebhookConfiguration", "ValidatingWebhookConfiguration", name)
+			return err
+		}
+		if legacy {
+			validatingList.Items = append(validatingList.Items, *cr)
+		}
+	}
+	for i := range validatingList.Items {
+		cr := &validatingList.Items[i]
+		if webhookConfig.isDynamic(cr.Labels) || !webhookConfig.ownsConfiguration(cr.Name) {
+			continue
+		}
+		webhookNames, ok := registered[cr.Name]
+		if !ok {
+			logger.Info("Deleting ValidatingWebhookConfiguration as it's no longer registered", "ValidatingWebhookConfiguration", cr.Name)
+			if err := client.Delete(ctx, cr); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete ValidatingWebhookConfiguration", "ValidatingWebhookConfiguration", cr.Name)
+				return err
+			}
+			continue
+		}
+
+		names := make([]string, 0, len(cr.Webhooks))
+		for _, webhook := range cr.Webhooks {
+			names = append(names, webhook.Name)
+		}
+		if err := removeWebhooks(ctx, client, cr, names, webhookNames); err != nil {
+			logger.Error(err, "Failed to remove unregistered webhooks", "ValidatingWebhookConfiguration", cr.Name)
 			return err
 		}
 	}
@@ -200,21 +537,30 @@ func (webhookConfig *CSWebhookConfig) Reconcile(ctx context.Context, client k8sc
 	return nil
 }
 
+// GetRules returns the Rule of the webhook, if it's set, followed by its Rules
+func (webhook CSWebhook) GetRules() []RuleWithOperations {
+	rules := []RuleWithOperations{}
+	if len(webhook.Rule.Operations) > 0 || len(webhook.Rule.Resources) > 0 {
+		rules = append(rules, webhook.Rule)
+	}
+	return append(rules, webhook.Rules...)
+}
+
 // ReconcileService creates or updates the service that points to the Pod
-func (webhookConfig *CSWebhookConfig) ReconcileService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner, namespace string) error {
+func (webhookConfig *CSWebhookConfig) ReconcileService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner) error {
 
-	klog.Info("Reconciling common service webhook service")
+	logf.FromContext(ctx).Info("Reconciling common service webhook service", "Service", webhookConfig.ServiceName)
 	// Get the service. If it's not found, create it
 	service := &corev1.Service{}
 	if err := client.Get(ctx, k8sclient.ObjectKey{
-		Namespace: namespace,
-		Name:      operatorPodServiceName,
+		Namespace: webhookConfig.Namespace,
+		Name:      webhookConfig.ServiceName,
 	}, service); err != nil {
 		if !errors.IsNotFound(err) {
 			return err
 		}
 
-		return createService(ctx, client, owner, namespace)
+		return webhookConfig.createService(ctx, client, owner)
 	}
 
 	// If the existing service has a different .spec.clusterIP value, delete it
@@ -224,16 +570,17 @@ func (webhookConfig *CSWebhookConfig) ReconcileService(ctx context.Context, clie
 		}
 	}
 
-	return createService(ctx, client, owner, namespace)
+	return webhookConfig.createService(ctx, client, owner)
 }
 
-func createService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner, namespace string) error {
-	klog.Info("Creating common service webhook service")
+func (webhookConfig *CSWebhookConfig) createService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner) error {
+	logger := logf.FromContext(ctx)
+	logger.Info("Creating common service webhook service", "Service", webhookConfig.ServiceName)
 
 	service := &corev1.Service{
 		ObjectMeta: v1.ObjectMeta{
-			Name:      operatorPodServiceName,
-			Namespace: namespace,
+			Name:      webhookConfig.ServiceName,
+			Namespace: webhookConfig.Namespace,
 		},
 	}
 	_, err := controllerutil.CreateOrUpdate(ctx, client, service, func() error {
@@ -241,37 +588,37 @@ func createService(ctx context.Context, client k8sclient.Client, owner ownerutil
 			ownerutil.EnsureOwner(service, owner)
 		}
 
-		if service.Annotations == nil {
-			service.Annotations = map[string]string{}
+		if webhookConfig.CertProvider == CertProviderServiceCA {
+			if service.Annotations == nil {
+				service.Annotations = map[string]string{}
+			}
+			service.Annotations[caServiceAnnotation] = webhookConfig.CertSecretName
 		}
-		service.Annotations[caServiceAnnotation] = "cs-webhook-cert"
 		service.Spec.ClusterIP = "None"
-		service.Spec.Selector = map[string]string{
-			"name": "ibm-common-service-webhook",
-		}
+		service.Spec.Selector = webhookConfig.PodSelector
 		service.Spec.Ports = []corev1.ServicePort{
 			{
 				Protocol:   corev1.ProtocolTCP,
-				Port:       int32(servicePort),
-				TargetPort: intstr.FromInt(operatorPodPort),
+				Port:       int32(webhookConfig.ServicePort),
+				TargetPort: intstr.FromInt(webhookConfig.Port),
 			},
 		}
 
 		return nil
 	})
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "Failed to create common service webhook service")
 	}
 	return err
 }
 
 // setupCerts waits for the secret created for the operator Service to exist, and
 // when it's ready, extracts the certificates and saves them in webhookConfig.CertDir
-func (webhookConfig *CSWebhookConfig) setupCerts(ctx context.Context, client k8sclient.Client, namespace string) error {
+func (webhookConfig *CSWebhookConfig) setupCerts(ctx context.Context, client k8sclient.Client) error {
 	// Wait for the secret to te created
 	secret := &corev1.Secret{}
 	err := wait.PollImmediate(time.Second*1, time.Second*30, func() (bool, error) {
-		err := client.Get(ctx, k8sclient.ObjectKey{Namespace: namespace, Name: "cs-webhook-cert"}, secret)
+		err := client.Get(ctx, k8sclient.ObjectKey{Namespace: webhookConfig.Namespace, Name: webhookConfig.CertSecretName}, secret)
 		if err != nil {
 			if errors.IsNotFound(err) {
 				return false, nil
@@ -293,15 +640,15 @@ func (webhookConfig *CSWebhookConfig) setupCerts(ctx context.Context, client k8s
 	return webhookConfig.saveCertFromSecret(secret.Data, "tls.crt")
 }
 
-func (webhookConfig *CSWebhookConfig) waitForCAInConfigMap(ctx context.Context, client k8sclient.Client, namespace string) ([]byte, error) {
-	klog.Info("Waiting for common service webhook CA generated")
+func (webhookConfig *CSWebhookConfig) waitForCAInConfigMap(ctx context.Context, client k8sclient.Client) ([]byte, error) {
+	logf.FromContext(ctx).Info("Waiting for common service webhook CA generated", "ConfigMap", webhookConfig.CAConfigMap)
 
 	var caBundle []byte
 
 	err := wait.PollImmediate(time.Second, time.Second*30, func() (bool, error) {
 		caConfigMap := &corev1.ConfigMap{}
 		if err := client.Get(ctx,
-			k8sclient.ObjectKey{Name: webhookConfig.CAConfigMap, Namespace: namespace},
+			k8sclient.ObjectKey{Name: webhookConfig.CAConfigMap, Namespace: webhookConfig.Namespace},
 			caConfigMap,
 		); err != nil {
 			if errors.IsNotFound(err) {
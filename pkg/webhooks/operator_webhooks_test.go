@@ -0,0 +1,236 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhooks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var managedLabels = map[string]string{"managed-by-common-service-webhook": "true"}
+
+func mutatingConfiguration(name string, labels map[string]string, webhookNames ...string) *admissionregistrationv1.MutatingWebhookConfiguration {
+	cr := &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	for _, webhookName := range webhookNames {
+		cr.Webhooks = append(cr.Webhooks, admissionregistrationv1.MutatingWebhook{Name: webhookName})
+	}
+	return cr
+}
+
+func validatingConfiguration(name string, labels map[string]string, webhookNames ...string) *admissionregistrationv1.ValidatingWebhookConfiguration {
+	cr := &admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	for _, webhookName := range webhookNames {
+		cr.Webhooks = append(cr.Webhooks, admissionregistrationv1.ValidatingWebhook{Name: webhookName})
+	}
+	return cr
+}
+
+func withLabel(labels map[string]string, key, value string) map[string]string {
+	merged := map[string]string{key: value}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// listConfigurations returns the webhook names of each configuration, by name
+func listConfigurations(t *testing.T, client k8sclient.Client) map[string][]string {
+	t.Helper()
+	got := map[string][]string{}
+	mutatingList := &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	if err := client.List(context.TODO(), mutatingList); err != nil {
+		t.Fatal(err)
+	}
+	for _, cr := range mutatingList.Items {
+		got[cr.Name] = []string{}
+		for _, webhook := range cr.Webhooks {
+			got[cr.Name] = append(got[cr.Name], webhook.Name)
+		}
+	}
+	validatingList := &admissionregistrationv1.ValidatingWebhookConfigurationList{}
+	if err := client.List(context.TODO(), validatingList); err != nil {
+		t.Fatal(err)
+	}
+	for _, cr := range validatingList.Items {
+		got[cr.Name] = []string{}
+		for _, webhook := range cr.Webhooks {
+			got[cr.Name] = append(got[cr.Name], webhook.Name)
+		}
+	}
+	return got
+}
+
+func TestPruneWebhookConfigurations(t *testing.T) {
+	suffixLabels := map[string]string{"managed-by-common-service-webhook-b": "true"}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		pruneDynamic bool
+		webhooks     []CSWebhook
+		existing     []k8sclient.Object
+		want         map[string][]string
+	}{
+		{
+			name: "labeled configuration no longer registered",
+			webhooks: []CSWebhook{
+				{Name: "registered", WebhookName: "a.operator.ibm.com"},
+			},
+			existing: []k8sclient.Object{
+				mutatingConfiguration("registered", managedLabels, "a.operator.ibm.com"),
+				mutatingConfiguration("unregistered", managedLabels, "b.operator.ibm.com"),
+				validatingConfiguration("unregistered", managedLabels, "c.operator.ibm.com"),
+				mutatingConfiguration("unmanaged", nil, "d.operator.ibm.com"),
+			},
+			want: map[string][]string{
+				"registered": {"a.operator.ibm.com"},
+				"unmanaged":  {"d.operator.ibm.com"},
+			},
+		},
+		{
+			name: "legacy configurations without suffix",
+			existing: []k8sclient.Object{
+				mutatingConfiguration("ibm-common-service-webhook-configuration", nil, "a.operator.ibm.com"),
+				mutatingConfiguration("ibm-operandrequest-webhook-configuration", map[string]string{"app": "other"}, "b.operator.ibm.com"),
+				validatingConfiguration("ibm-cs-ns-mapping-webhook-configuration", nil, "c.operator.ibm.com"),
+			},
+			want: map[string][]string{},
+		},
+		{
+			name: "legacy configurations with suffix",
+			opts: Options{ConfigurationSuffix: "b"},
+			existing: []k8sclient.Object{
+				mutatingConfiguration("ibm-common-service-webhook-configuration", nil, "a.operator.ibm.com"),
+				validatingConfiguration("ibm-cs-ns-mapping-webhook-configuration", nil, "c.operator.ibm.com"),
+			},
+			want: map[string][]string{
+				"ibm-common-service-webhook-configuration": {"a.operator.ibm.com"},
+				"ibm-cs-ns-mapping-webhook-configuration":  {"c.operator.ibm.com"},
+			},
+		},
+		{
+			name: "configurations of another suffix",
+			opts: Options{ConfigurationSuffix: "b", Labels: managedLabels},
+			existing: []k8sclient.Object{
+				mutatingConfiguration("unregistered-b", managedLabels, "a.operator.ibm.com"),
+				mutatingConfiguration("unregistered-c", managedLabels, "b.operator.ibm.com"),
+				mutatingConfiguration("unregistered", managedLabels, "c.operator.ibm.com"),
+			},
+			want: map[string][]string{
+				"unregistered-c": {"b.operator.ibm.com"},
+				"unregistered":   {"c.operator.ibm.com"},
+			},
+		},
+		{
+			name: "suffix labels",
+			opts: Options{ConfigurationSuffix: "b"},
+			existing: []k8sclient.Object{
+				mutatingConfiguration("unregistered-b", suffixLabels, "a.operator.ibm.com"),
+				mutatingConfiguration("unregistered", managedLabels, "b.operator.ibm.com"),
+			},
+			want: map[string][]string{
+				"unregistered": {"b.operator.ibm.com"},
+			},
+		},
+		{
+			name: "dynamic configurations are skipped",
+			existing: []k8sclient.Object{
+				mutatingConfiguration("dynamic", withLabel(managedLabels, DynamicWebhookLabel, "true"), "a.operator.ibm.com"),
+			},
+			want: map[string][]string{
+				"dynamic": {"a.operator.ibm.com"},
+			},
+		},
+		{
+			name:         "dynamic configurations are pruned",
+			pruneDynamic: true,
+			existing: []k8sclient.Object{
+				mutatingConfiguration("dynamic", withLabel(managedLabels, DynamicWebhookLabel, "true"), "a.operator.ibm.com"),
+			},
+			want: map[string][]string{},
+		},
+		{
+			name: "unregistered and disabled webhooks are removed",
+			webhooks: []CSWebhook{
+				{Name: "mutating", WebhookName: "a.operator.ibm.com"},
+				{Name: "mutating", WebhookName: "c.operator.ibm.com"},
+				{Name: "mutating", WebhookName: "d.operator.ibm.com", Switch: "d", Disabled: true},
+				{Name: "validating", WebhookName: "e.operator.ibm.com"},
+			},
+			existing: []k8sclient.Object{
+				mutatingConfiguration("mutating", managedLabels, "a.operator.ibm.com", "b.operator.ibm.com", "c.operator.ibm.com", "d.operator.ibm.com"),
+				validatingConfiguration("validating", managedLabels, "f.operator.ibm.com", "e.operator.ibm.com"),
+			},
+			want: map[string][]string{
+				"mutating":   {"a.operator.ibm.com", "c.operator.ibm.com"},
+				"validating": {"e.operator.ibm.com"},
+			},
+		},
+		{
+			name: "every webhook disabled",
+			webhooks: []CSWebhook{
+				{Name: "mutating", WebhookName: "a.operator.ibm.com", Switch: "a", Disabled: true},
+			},
+			existing: []k8sclient.Object{
+				mutatingConfiguration("mutating", managedLabels, "a.operator.ibm.com"),
+			},
+			want: map[string][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(tt.existing...).Build()
+			webhookConfig := NewCSWebhookConfig(tt.opts)
+			webhookConfig.PruneDynamicWebhooks = tt.pruneDynamic
+			for _, webhook := range tt.webhooks {
+				webhookConfig.AddWebhook(webhook)
+			}
+
+			if err := webhookConfig.pruneWebhookConfigurations(context.TODO(), client); err != nil {
+				t.Fatalf("pruneWebhookConfigurations() error = %v", err)
+			}
+			if got := listConfigurations(t, client); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configurations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveWebhooksGuard(t *testing.T) {
+	cr := mutatingConfiguration("mutating", managedLabels, "a.operator.ibm.com", "b.operator.ibm.com")
+	client := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(cr).Build()
+
+	// The names were read before the webhooks were reordered, so the index
+	// of b now points to a
+	stale := []string{"b.operator.ibm.com", "a.operator.ibm.com"}
+	registered := map[string]struct{}{"a.operator.ibm.com": {}}
+	if err := removeWebhooks(context.TODO(), client, cr.DeepCopy(), stale, registered); err == nil {
+		t.Fatal("removeWebhooks() succeeded, want the test operation to fail")
+	}
+
+	if got, want := listConfigurations(t, client)["mutating"], []string{"a.operator.ibm.com", "b.operator.ibm.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("webhooks = %v, want %v", got, want)
+	}
+}
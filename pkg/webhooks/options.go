@@ -0,0 +1,264 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhooks
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/utils"
+)
+
+const (
+	defaultServiceName    = "ibm-common-service-webhook"
+	defaultPort           = 8443
+	defaultServicePort    = 443
+	defaultCertDir        = "/etc/ssl/certs/webhook"
+	defaultCertSecretName = "cs-webhook-cert"
+	defaultCAConfigMap    = "ibm-cs-operator-webhook-ca"
+	webhookConfigLabel    = "managed-by-common-service-webhook"
+)
+
+// Providers of the webhook server certificates
+const (
+	// CertProviderServiceCA uses the OpenShift service CA operator, which
+	// generates the certificates Secret of the Service and injects the CA in
+	// the CA ConfigMap
+	CertProviderServiceCA = "service-ca"
+
+	// CertProviderManual uses the tls.crt, tls.key and ca.crt files mounted in
+	// the cert dir, e.g. by cert-manager
+	CertProviderManual = "manual"
+)
+
+// Options are the settings of a CSWebhookConfig. Empty fields are set to the
+// defaults of the ibm-common-service-webhook deployment
+// +k8s:deepcopy-gen=false
+type Options struct {
+	Namespace           string            `json:"namespace,omitempty"`
+	ServiceName         string            `json:"serviceName,omitempty"`
+	Port                int               `json:"port,omitempty"`
+	ServicePort         int               `json:"servicePort,omitempty"`
+	CertProvider        string            `json:"certProvider,omitempty"`
+	CertDir             string            `json:"certDir,omitempty"`
+	CertSecretName      string            `json:"certSecretName,omitempty"`
+	CAConfigMap         string            `json:"caConfigMap,omitempty"`
+	Labels              map[string]string `json:"labels,omitempty"`
+	PodSelector         map[string]string `json:"podSelector,omitempty"`
+	ConfigurationSuffix string            `json:"configurationSuffix,omitempty"`
+}
+
+// DefaultLabels returns the labels of the webhook configurations of the
+// instance with the given configuration suffix. Each suffix gets its own
+// label, so instances that only set a suffix don't prune each other's
+// configurations
+func DefaultLabels(suffix string) map[string]string {
+	if suffix == "" {
+		return map[string]string{webhookConfigLabel: "true"}
+	}
+	return map[string]string{webhookConfigLabel + "-" + suffix: "true"}
+}
+
+// EffectiveLabels returns the labels of the options, or the default labels of
+// their configuration suffix when they're empty
+func (o *Options) EffectiveLabels() map[string]string {
+	if len(o.Labels) == 0 {
+		return DefaultLabels(o.ConfigurationSuffix)
+	}
+	return o.Labels
+}
+
+// DefaultPodSelector returns the selector of the operator pods of the instance
+// with the given Service name, which the deployment sets as their name label
+func DefaultPodSelector(serviceName string) map[string]string {
+	return map[string]string{"name": serviceName}
+}
+
+// EffectivePodSelector returns the pod selector of the options, or the
+// default one of their Service name when it's empty
+func (o *Options) EffectivePodSelector() map[string]string {
+	if len(o.PodSelector) == 0 {
+		return DefaultPodSelector(o.ServiceName)
+	}
+	return o.PodSelector
+}
+
+// DefaultOptions returns the Options of the ibm-common-service-webhook
+// deployment, with the namespace read from OPERATOR_NAMESPACE. The labels and
+// the pod selector are derived from the configuration suffix and the Service
+// name by NewCSWebhookConfig
+func DefaultOptions() Options {
+	return Options{
+		Namespace:      utils.GetOperatorNamespace(),
+		ServiceName:    defaultServiceName,
+		Port:           defaultPort,
+		ServicePort:    defaultServicePort,
+		CertProvider:   CertProviderServiceCA,
+		CertDir:        defaultCertDir,
+		CertSecretName: defaultCertSecretName,
+		CAConfigMap:    defaultCAConfigMap,
+	}
+}
+
+// BindFlags binds the options to flags of fs, so they can be overridden from
+// the command line
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Namespace, "webhook-namespace", o.Namespace, "Namespace of the webhook Service, CA ConfigMap and certificates Secret")
+	fs.StringVar(&o.ServiceName, "webhook-service-name", o.ServiceName, "Name of the Service that exposes the webhook server")
+	fs.IntVar(&o.Port, "webhook-port", o.Port, "Port the webhook server listens on")
+	fs.IntVar(&o.ServicePort, "webhook-service-port", o.ServicePort, "Port exposed by the webhook Service")
+	fs.StringVar(&o.CertProvider, "webhook-cert-provider", o.CertProvider, "Provider of the webhook server certificates, service-ca or manual")
+	fs.StringVar(&o.CertDir, "webhook-cert-dir", o.CertDir, "Directory where the webhook server certificates are saved")
+	fs.StringVar(&o.CertSecretName, "webhook-cert-secret", o.CertSecretName, "Name of the Secret generated with the webhook Service certificates")
+	fs.StringVar(&o.CAConfigMap, "webhook-ca-configmap", o.CAConfigMap, "Name of the ConfigMap where the CA certificate is injected")
+	fs.Var((*labelsValue)(&o.Labels), "webhook-labels", "Comma-separated key=value labels of the webhook configurations managed by this instance, derived from the configuration suffix by default")
+	fs.Var((*labelsValue)(&o.PodSelector), "webhook-pod-selector", "Single key=value label selecting the operator pods, name=<webhook service name> by default")
+	fs.StringVar(&o.ConfigurationSuffix, "webhook-configuration-suffix", o.ConfigurationSuffix, "Suffix of the webhook configuration names managed by this instance")
+}
+
+// NewCSWebhookConfig returns a CSWebhookConfig with the given options, where
+// the empty ones are set to their defaults
+func NewCSWebhookConfig(opts Options) *CSWebhookConfig {
+	defaults := DefaultOptions()
+	if opts.Namespace == "" {
+		opts.Namespace = defaults.Namespace
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = defaults.ServiceName
+	}
+	if opts.Port == 0 {
+		opts.Port = defaults.Port
+	}
+	if opts.ServicePort == 0 {
+		opts.ServicePort = defaults.ServicePort
+	}
+	if opts.CertProvider == "" {
+		opts.CertProvider = defaults.CertProvider
+	}
+	if opts.CertDir == "" {
+		opts.CertDir = defaults.CertDir
+	}
+	if opts.CertSecretName == "" {
+		opts.CertSecretName = defaults.CertSecretName
+	}
+	if opts.CAConfigMap == "" {
+		opts.CAConfigMap = defaults.CAConfigMap
+	}
+	opts.Labels = opts.EffectiveLabels()
+	opts.PodSelector = opts.EffectivePodSelector()
+
+	return &CSWebhookConfig{
+		Namespace:           opts.Namespace,
+		ServiceName:         opts.ServiceName,
+		Port:                opts.Port,
+		ServicePort:         opts.ServicePort,
+		CertProvider:        opts.CertProvider,
+		CertDir:             opts.CertDir,
+		CertSecretName:      opts.CertSecretName,
+		CAConfigMap:         opts.CAConfigMap,
+		Labels:              opts.Labels,
+		PodSelector:         opts.PodSelector,
+		ConfigurationSuffix: opts.ConfigurationSuffix,
+		Webhooks:            []CSWebhook{},
+	}
+}
+
+// Validate returns the errors of the options, with their field paths under
+// fldPath
+func (o *Options) Validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if o.Namespace == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("namespace"), "set OPERATOR_NAMESPACE or --webhook-namespace"))
+	}
+	for _, msg := range validation.IsDNS1123Label(o.Namespace) {
+		if o.Namespace != "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("namespace"), o.Namespace, msg))
+		}
+	}
+	for _, msg := range validation.IsDNS1035Label(o.ServiceName) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("serviceName"), o.ServiceName, msg))
+	}
+	for _, msg := range validation.IsValidPortNum(o.Port) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), o.Port, msg))
+	}
+	for _, msg := range validation.IsValidPortNum(o.ServicePort) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("servicePort"), o.ServicePort, msg))
+	}
+	switch o.CertProvider {
+	case CertProviderServiceCA:
+		for _, msg := range validation.IsDNS1123Subdomain(o.CertSecretName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("certSecretName"), o.CertSecretName, msg))
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(o.CAConfigMap) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("caConfigMap"), o.CAConfigMap, msg))
+		}
+	case CertProviderManual:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("certProvider"), o.CertProvider, []string{CertProviderServiceCA, CertProviderManual}))
+	}
+	if o.CertDir == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("certDir"), ""))
+	}
+	allErrs = append(allErrs, metav1validation.ValidateLabels(o.EffectiveLabels(), fldPath.Child("labels"))...)
+	// The operator pods are excluded from the webhooks with a NotIn
+	// requirement per label, which would also exclude the pods with only one
+	// of several labels
+	if len(o.PodSelector) > 1 {
+		allErrs = append(allErrs, field.TooMany(fldPath.Child("podSelector"), len(o.PodSelector), 1))
+	}
+	allErrs = append(allErrs, metav1validation.ValidateLabels(o.EffectivePodSelector(), fldPath.Child("podSelector"))...)
+	if o.ConfigurationSuffix != "" {
+		for _, msg := range validation.IsDNS1123Label(o.ConfigurationSuffix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("configurationSuffix"), o.ConfigurationSuffix, msg))
+		}
+	}
+	return allErrs
+}
+
+// labelsValue is a flag.Value of comma-separated key=value pairs
+type labelsValue map[string]string
+
+func (v *labelsValue) String() string {
+	pairs := []string{}
+	for key, value := range *v {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *labelsValue) Set(s string) error {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	*v = labels
+	return nil
+}
@@ -0,0 +1,94 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhooks
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestNewCSWebhookConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            Options
+		wantLabels      map[string]string
+		wantPodSelector map[string]string
+	}{
+		{
+			name:            "defaults",
+			opts:            Options{},
+			wantLabels:      map[string]string{"managed-by-common-service-webhook": "true"},
+			wantPodSelector: map[string]string{"name": "ibm-common-service-webhook"},
+		},
+		{
+			name:            "derived from the suffix and the Service name",
+			opts:            Options{ServiceName: "webhook-b", ConfigurationSuffix: "b"},
+			wantLabels:      map[string]string{"managed-by-common-service-webhook-b": "true"},
+			wantPodSelector: map[string]string{"name": "webhook-b"},
+		},
+		{
+			name:            "set",
+			opts:            Options{Labels: map[string]string{"instance": "b"}, PodSelector: map[string]string{"app": "b"}},
+			wantLabels:      map[string]string{"instance": "b"},
+			wantPodSelector: map[string]string{"app": "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCSWebhookConfig(tt.opts)
+			if !reflect.DeepEqual(c.Labels, tt.wantLabels) {
+				t.Errorf("Labels = %v, want %v", c.Labels, tt.wantLabels)
+			}
+			if !reflect.DeepEqual(c.PodSelector, tt.wantPodSelector) {
+				t.Errorf("PodSelector = %v, want %v", c.PodSelector, tt.wantPodSelector)
+			}
+		})
+	}
+}
+
+func TestValidatePodSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		podSelector map[string]string
+		wantErr     bool
+	}{
+		{name: "default", podSelector: nil},
+		{name: "single label", podSelector: map[string]string{"app": "webhook"}},
+		{name: "several labels", podSelector: map[string]string{"app.kubernetes.io/managed-by": "olm", "name": "webhook"}, wantErr: true},
+		{name: "invalid label", podSelector: map[string]string{"app": "not a value"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Namespace = "ibm-common-services"
+			opts.PodSelector = tt.podSelector
+			gotErr := false
+			for _, err := range opts.Validate(field.NewPath("server")) {
+				if err.Field == "server.podSelector" {
+					gotErr = true
+				}
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("Validate() podSelector error = %v, want %v", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
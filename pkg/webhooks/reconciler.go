@@ -22,19 +22,25 @@ import (
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog"
 	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-
-	"github.com/IBM/ibm-common-service-webhook/pkg/utils"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // WebhookReconciler knows how to reconcile webhook configuration CRs
 type WebhookReconciler interface {
 	SetName(name string)
 	SetWebhookName(webhookName string)
-	SetRule(rule RuleWithOperations)
+	SetRules(rules []RuleWithOperations)
 	SetNsSelector(selector v1.LabelSelector)
+	SetObjectSelector(selector v1.LabelSelector)
+	SetFailurePolicy(policy *admissionregistrationv1.FailurePolicyType)
+	SetTimeoutSeconds(timeoutSeconds *int32)
+	SetSideEffects(sideEffects *admissionregistrationv1.SideEffectClass)
+	SetMatchPolicy(policy *admissionregistrationv1.MatchPolicyType)
+	SetReinvocationPolicy(policy *admissionregistrationv1.ReinvocationPolicyType)
+	SetService(namespace, name string, port int32)
+	SetLabels(labels map[string]string)
+	SetOwnerReferences(ownerReferences []v1.OwnerReference)
 	Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error
 }
 
@@ -54,9 +60,9 @@ func (reconciler *CompositeWebhookReconciler) SetWebhookName(webhookName string)
 	}
 }
 
-func (reconciler *CompositeWebhookReconciler) SetRule(rule RuleWithOperations) {
+func (reconciler *CompositeWebhookReconciler) SetRules(rules []RuleWithOperations) {
 	for _, innerReconciler := range reconciler.Reconcilers {
-		innerReconciler.SetRule(rule)
+		innerReconciler.SetRules(rules)
 	}
 }
 
@@ -66,6 +72,60 @@ func (reconciler *CompositeWebhookReconciler) SetNsSelector(selector v1.LabelSel
 	}
 }
 
+func (reconciler *CompositeWebhookReconciler) SetObjectSelector(selector v1.LabelSelector) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetObjectSelector(selector)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetFailurePolicy(policy *admissionregistrationv1.FailurePolicyType) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetFailurePolicy(policy)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetTimeoutSeconds(timeoutSeconds *int32) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetTimeoutSeconds(timeoutSeconds)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetSideEffects(sideEffects *admissionregistrationv1.SideEffectClass) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetSideEffects(sideEffects)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetMatchPolicy(policy *admissionregistrationv1.MatchPolicyType) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetMatchPolicy(policy)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetReinvocationPolicy(policy *admissionregistrationv1.ReinvocationPolicyType) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetReinvocationPolicy(policy)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetService(namespace, name string, port int32) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetService(namespace, name, port)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetLabels(labels map[string]string) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetLabels(labels)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) SetOwnerReferences(ownerReferences []v1.OwnerReference) {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerReconciler.SetOwnerReferences(ownerReferences)
+	}
+}
+
 func (reconciler *CompositeWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error {
 	for _, innerReconciler := range reconciler.Reconcilers {
 		if err := innerReconciler.Reconcile(ctx, client, caBundle); err != nil {
@@ -80,78 +140,99 @@ type ValidatingWebhookReconciler struct {
 	Path              string
 	name              string
 	webhookName       string
-	rule              RuleWithOperations
+	rules             []RuleWithOperations
 	NameSpaceSelector v1.LabelSelector
+	ObjectSelector    v1.LabelSelector
+	failurePolicy     *admissionregistrationv1.FailurePolicyType
+	timeoutSeconds    *int32
+	sideEffects       *admissionregistrationv1.SideEffectClass
+	matchPolicy       *admissionregistrationv1.MatchPolicyType
+	service           admissionregistrationv1.ServiceReference
+	labels            map[string]string
+	ownerReferences   []v1.OwnerReference
 }
 
 type MutatingWebhookReconciler struct {
-	Path              string
-	name              string
-	webhookName       string
-	rule              RuleWithOperations
-	NameSpaceSelector v1.LabelSelector
+	Path               string
+	name               string
+	webhookName        string
+	rules              []RuleWithOperations
+	NameSpaceSelector  v1.LabelSelector
+	ObjectSelector     v1.LabelSelector
+	failurePolicy      *admissionregistrationv1.FailurePolicyType
+	timeoutSeconds     *int32
+	sideEffects        *admissionregistrationv1.SideEffectClass
+	matchPolicy        *admissionregistrationv1.MatchPolicyType
+	reinvocationPolicy *admissionregistrationv1.ReinvocationPolicyType
+	service            admissionregistrationv1.ServiceReference
+	labels             map[string]string
+	ownerReferences    []v1.OwnerReference
 }
 
+const defaultTimeoutSeconds = int32(10)
+
 // Reconcile MutatingWebhookConfiguration
 func (reconciler *MutatingWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error {
 	var (
 		sideEffects    = admissionregistrationv1.SideEffectClassNone
-		port           = int32(servicePort)
 		matchPolicy    = admissionregistrationv1.Exact
-		ignorePolicy   = admissionregistrationv1.Ignore
-		timeoutSeconds = int32(10)
+		failurePolicy  = admissionregistrationv1.Ignore
+		timeoutSeconds = defaultTimeoutSeconds
 	)
+	if reconciler.sideEffects != nil {
+		sideEffects = *reconciler.sideEffects
+	}
+	if reconciler.matchPolicy != nil {
+		matchPolicy = *reconciler.matchPolicy
+	}
+	if reconciler.failurePolicy != nil {
+		failurePolicy = *reconciler.failurePolicy
+	}
+	if reconciler.timeoutSeconds != nil {
+		timeoutSeconds = *reconciler.timeoutSeconds
+	}
+
+	service := reconciler.service
+	service.Path = &reconciler.Path
 
-	namespace := utils.GetWatchNamespace()
+	webhook := admissionregistrationv1.MutatingWebhook{
+		Name:        fmt.Sprintf("%s", reconciler.webhookName),
+		SideEffects: &sideEffects,
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			CABundle: caBundle,
+			Service:  &service,
+		},
+		Rules:                   toAdmissionRules(reconciler.rules),
+		MatchPolicy:             &matchPolicy,
+		AdmissionReviewVersions: []string{"v1"},
+		FailurePolicy:           &failurePolicy,
+		TimeoutSeconds:          &timeoutSeconds,
+		ReinvocationPolicy:      reconciler.reinvocationPolicy,
+		NamespaceSelector:       &reconciler.NameSpaceSelector,
+		ObjectSelector:          &reconciler.ObjectSelector,
+	}
 
+	// Only the fields set here are owned by the operator, and each webhook of
+	// the configuration has its own field manager, so the webhooks don't remove
+	// each other's entries and the fields managed by others are kept
 	cr := &admissionregistrationv1.MutatingWebhookConfiguration{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: admissionregistrationv1.SchemeGroupVersion.String(),
+			Kind:       "MutatingWebhookConfiguration",
+		},
 		ObjectMeta: v1.ObjectMeta{
-			Name: fmt.Sprintf("%s", reconciler.name),
+			Name:            fmt.Sprintf("%s", reconciler.name),
+			Labels:          reconciler.labels,
+			OwnerReferences: reconciler.ownerReferences,
 		},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{webhook},
 	}
 
-	webhookLabel := make(map[string]string)
-	webhookLabel["managed-by-common-service-webhook"] = "true"
-
-	klog.Infof("Creating/Updating MutatingWebhook %s", fmt.Sprintf("%s", reconciler.name))
-	_, err := controllerutil.CreateOrUpdate(ctx, client, cr, func() error {
-		cr.Webhooks = []admissionregistrationv1.MutatingWebhook{
-			{
-				Name:        fmt.Sprintf("%s", reconciler.webhookName),
-				SideEffects: &sideEffects,
-				ClientConfig: admissionregistrationv1.WebhookClientConfig{
-					CABundle: caBundle,
-					Service: &admissionregistrationv1.ServiceReference{
-						Namespace: namespace,
-						Name:      operatorPodServiceName,
-						Path:      &reconciler.Path,
-						Port:      &port,
-					},
-				},
-				Rules: []admissionregistrationv1.RuleWithOperations{
-					{
-						Operations: reconciler.rule.Operations,
-						Rule: admissionregistrationv1.Rule{
-							APIGroups:   reconciler.rule.APIGroups,
-							APIVersions: reconciler.rule.APIVersions,
-							Resources:   reconciler.rule.Resources,
-							Scope:       &reconciler.rule.Scope,
-						},
-					},
-				},
-				MatchPolicy:             &matchPolicy,
-				AdmissionReviewVersions: []string{"v1"},
-				FailurePolicy:           &ignorePolicy,
-				TimeoutSeconds:          &timeoutSeconds,
-			},
-		}
-		for index := range cr.Webhooks {
-			cr.Webhooks[index].NamespaceSelector = &reconciler.NameSpaceSelector
-		}
-		return nil
-	})
+	logger := logf.FromContext(ctx, "MutatingWebhookConfiguration", reconciler.name, "webhook", reconciler.webhookName)
+	logger.Info("Applying MutatingWebhookConfiguration")
+	err := client.Patch(ctx, cr, k8sclient.Apply, webhookFieldOwner(reconciler.webhookName), k8sclient.ForceOwnership)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "Failed to apply MutatingWebhookConfiguration")
 	}
 	return err
 }
@@ -160,66 +241,70 @@ func (reconciler *MutatingWebhookReconciler) Reconcile(ctx context.Context, clie
 func (reconciler *ValidatingWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error {
 	var (
 		sideEffects    = admissionregistrationv1.SideEffectClassNone
-		port           = int32(servicePort)
 		matchPolicy    = admissionregistrationv1.Exact
 		failurePolicy  = admissionregistrationv1.Fail
-		timeoutSeconds = int32(10)
+		timeoutSeconds = defaultTimeoutSeconds
 	)
+	if reconciler.sideEffects != nil {
+		sideEffects = *reconciler.sideEffects
+	}
+	if reconciler.matchPolicy != nil {
+		matchPolicy = *reconciler.matchPolicy
+	}
+	if reconciler.failurePolicy != nil {
+		failurePolicy = *reconciler.failurePolicy
+	}
+	if reconciler.timeoutSeconds != nil {
+		timeoutSeconds = *reconciler.timeoutSeconds
+	}
 
-	namespace := utils.GetWatchNamespace()
+	service := reconciler.service
+	service.Path = &reconciler.Path
 
+	webhook := admissionregistrationv1.ValidatingWebhook{
+		Name:        fmt.Sprintf("%s", reconciler.webhookName),
+		SideEffects: &sideEffects,
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			CABundle: caBundle,
+			Service:  &service,
+		},
+		Rules:                   toAdmissionRules(reconciler.rules),
+		MatchPolicy:             &matchPolicy,
+		AdmissionReviewVersions: []string{"v1"},
+		FailurePolicy:           &failurePolicy,
+		TimeoutSeconds:          &timeoutSeconds,
+		NamespaceSelector:       &reconciler.NameSpaceSelector,
+		ObjectSelector:          &reconciler.ObjectSelector,
+	}
+
+	// Server-side applied with a field manager per webhook, as the mutating one
 	cr := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: admissionregistrationv1.SchemeGroupVersion.String(),
+			Kind:       "ValidatingWebhookConfiguration",
+		},
 		ObjectMeta: v1.ObjectMeta{
-			Name: fmt.Sprintf("%s", reconciler.name),
+			Name:            fmt.Sprintf("%s", reconciler.name),
+			Labels:          reconciler.labels,
+			OwnerReferences: reconciler.ownerReferences,
 		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{webhook},
 	}
 
-	webhookLabel := make(map[string]string)
-	webhookLabel["managed-by-common-service-webhook"] = "true"
-
-	klog.Infof("Creating/Updating ValidatingWebhook %s", fmt.Sprintf("%s", reconciler.name))
-	_, err := controllerutil.CreateOrUpdate(ctx, client, cr, func() error {
-		cr.Webhooks = []admissionregistrationv1.ValidatingWebhook{
-			{
-				Name:        fmt.Sprintf("%s", reconciler.webhookName),
-				SideEffects: &sideEffects,
-				ClientConfig: admissionregistrationv1.WebhookClientConfig{
-					CABundle: caBundle,
-					Service: &admissionregistrationv1.ServiceReference{
-						Namespace: namespace,
-						Name:      operatorPodServiceName,
-						Path:      &reconciler.Path,
-						Port:      &port,
-					},
-				},
-				Rules: []admissionregistrationv1.RuleWithOperations{
-					{
-						Operations: reconciler.rule.Operations,
-						Rule: admissionregistrationv1.Rule{
-							APIGroups:   reconciler.rule.APIGroups,
-							APIVersions: reconciler.rule.APIVersions,
-							Resources:   reconciler.rule.Resources,
-							Scope:       &reconciler.rule.Scope,
-						},
-					},
-				},
-				MatchPolicy:             &matchPolicy,
-				AdmissionReviewVersions: []string{"v1"},
-				FailurePolicy:           &failurePolicy,
-				TimeoutSeconds:          &timeoutSeconds,
-			},
-		}
-		for index := range cr.Webhooks {
-			cr.Webhooks[index].NamespaceSelector = &reconciler.NameSpaceSelector
-		}
-		return nil
-	})
+	logger := logf.FromContext(ctx, "ValidatingWebhookConfiguration", reconciler.name, "webhook", reconciler.webhookName)
+	logger.Info("Applying ValidatingWebhookConfiguration")
+	err := client.Patch(ctx, cr, k8sclient.Apply, webhookFieldOwner(reconciler.webhookName), k8sclient.ForceOwnership)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "Failed to apply ValidatingWebhookConfiguration")
 	}
 	return err
 }
 
+// webhookFieldOwner returns the field manager used to apply the given webhook
+func webhookFieldOwner(webhookName string) k8sclient.FieldOwner {
+	return k8sclient.FieldOwner(fmt.Sprintf("%s/%s", fieldManager, webhookName))
+}
+
 func (reconciler *ValidatingWebhookReconciler) SetName(name string) {
 	reconciler.name = name
 }
@@ -236,12 +321,12 @@ func (reconciler *MutatingWebhookReconciler) SetWebhookName(webhookName string)
 	reconciler.webhookName = webhookName
 }
 
-func (reconciler *ValidatingWebhookReconciler) SetRule(rule RuleWithOperations) {
-	reconciler.rule = rule
+func (reconciler *ValidatingWebhookReconciler) SetRules(rules []RuleWithOperations) {
+	reconciler.rules = rules
 }
 
-func (reconciler *MutatingWebhookReconciler) SetRule(rule RuleWithOperations) {
-	reconciler.rule = rule
+func (reconciler *MutatingWebhookReconciler) SetRules(rules []RuleWithOperations) {
+	reconciler.rules = rules
 }
 
 func (reconciler *MutatingWebhookReconciler) SetNsSelector(selector v1.LabelSelector) {
@@ -251,3 +336,93 @@ func (reconciler *MutatingWebhookReconciler) SetNsSelector(selector v1.LabelSele
 func (reconciler *ValidatingWebhookReconciler) SetNsSelector(selector v1.LabelSelector) {
 	reconciler.NameSpaceSelector = selector
 }
+
+func (reconciler *MutatingWebhookReconciler) SetObjectSelector(selector v1.LabelSelector) {
+	reconciler.ObjectSelector = selector
+}
+
+func (reconciler *ValidatingWebhookReconciler) SetObjectSelector(selector v1.LabelSelector) {
+	reconciler.ObjectSelector = selector
+}
+
+func (reconciler *MutatingWebhookReconciler) SetFailurePolicy(policy *admissionregistrationv1.FailurePolicyType) {
+	reconciler.failurePolicy = policy
+}
+
+func (reconciler *ValidatingWebhookReconciler) SetFailurePolicy(policy *admissionregistrationv1.FailurePolicyType) {
+	reconciler.failurePolicy = policy
+}
+
+func (reconciler *MutatingWebhookReconciler) SetTimeoutSeconds(timeoutSeconds *int32) {
+	reconciler.timeoutSeconds = timeoutSeconds
+}
+
+func (reconciler *ValidatingWebhookReconciler) SetTimeoutSeconds(timeoutSeconds *int32) {
+	reconciler.timeoutSeconds = timeoutSeconds
+}
+
+func (reconciler *MutatingWebhookReconciler) SetSideEffects(sideEffects *admissionregistrationv1.SideEffectClass) {
+	reconciler.sideEffects = sideEffects
+}
+
+func (reconciler *ValidatingWebhookReconciler) SetSideEffects(sideEffects *admissionregistrationv1.SideEffectClass) {
+	reconciler.sideEffects = sideEffects
+}
+
+func (reconciler *MutatingWebhookReconciler) SetMatchPolicy(policy *admissionregistrationv1.MatchPolicyType) {
+	reconciler.matchPolicy = policy
+}
+
+func (reconciler *ValidatingWebhookReconciler) SetMatchPolicy(policy *admissionregistrationv1.MatchPolicyType) {
+	reconciler.matchPolicy = policy
+}
+
+func (reconciler *MutatingWebhookReconciler) SetReinvocationPolicy(policy *admissionregistrationv1.ReinvocationPolicyType) {
+	reconciler.reinvocationPolicy = policy
+}
+
+// SetReinvocationPolicy does nothing, as reinvocation only applies to mutating webhooks
+func (reconciler *ValidatingWebhookReconciler) SetReinvocationPolicy(_ *admissionregistrationv1.ReinvocationPolicyType) {
+}
+
+// SetService sets the Service that the webhook configuration points to
+func (reconciler *MutatingWebhookReconciler) SetService(namespace, name string, port int32) {
+	reconciler.service = admissionregistrationv1.ServiceReference{
+		Namespace: namespace,
+		Name:      name,
+		Port:      &port,
+	}
+}
+
+// SetService sets the Service that the webhook configuration points to
+func (reconciler *ValidatingWebhookReconciler) SetService(namespace, name string, port int32) {
+	reconciler.service = admissionregistrationv1.ServiceReference{
+		Namespace: namespace,
+		Name:      name,
+		Port:      &port,
+	}
+}
+
+// SetLabels sets the labels that mark the webhook configuration as managed by
+// the operator instance, so it can be found and pruned once it's no longer
+// registered
+func (reconciler *MutatingWebhookReconciler) SetLabels(labels map[string]string) {
+	reconciler.labels = labels
+}
+
+// SetLabels sets the labels that mark the webhook configuration as managed by
+// the operator instance
+func (reconciler *ValidatingWebhookReconciler) SetLabels(labels map[string]string) {
+	reconciler.labels = labels
+}
+
+// SetOwnerReferences sets the owners of the webhook configuration, which is
+// garbage collected once they are deleted
+func (reconciler *MutatingWebhookReconciler) SetOwnerReferences(ownerReferences []v1.OwnerReference) {
+	reconciler.ownerReferences = ownerReferences
+}
+
+// SetOwnerReferences sets the owners of the webhook configuration
+func (reconciler *ValidatingWebhookReconciler) SetOwnerReferences(ownerReferences []v1.OwnerReference) {
+	reconciler.ownerReferences = ownerReferences
+}
@@ -16,7 +16,11 @@
 
 package webhooks
 
-import admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+import (
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
 
 // The `RuleWithOperations` and `Rule` types redefine the original ones from
 // k8s.io/api/admissionregistration/v1 in order to allow to define methods
@@ -46,12 +50,69 @@ func (rule RuleWithOperations) OneResource(apiGroup, apiVersion, resource string
 	return rule
 }
 
+// MultiResource sets every combination of the given API groups, versions and
+// resources as the target of the rule
+func (rule RuleWithOperations) MultiResource(apiGroups, apiVersions, resources []string) RuleWithOperations {
+	rule.APIGroups = append([]string{}, apiGroups...)
+	rule.APIVersions = append([]string{}, apiVersions...)
+	rule.Resources = append([]string{}, resources...)
+
+	return rule
+}
+
+// WithGroups adds API groups to the rule
+func (rule RuleWithOperations) WithGroups(apiGroups ...string) RuleWithOperations {
+	rule.APIGroups = append(append([]string{}, rule.APIGroups...), apiGroups...)
+	return rule
+}
+
+// WithVersions adds API versions to the rule
+func (rule RuleWithOperations) WithVersions(apiVersions ...string) RuleWithOperations {
+	rule.APIVersions = append(append([]string{}, rule.APIVersions...), apiVersions...)
+	return rule
+}
+
+// WithResources adds resources to the rule
+func (rule RuleWithOperations) WithResources(resources ...string) RuleWithOperations {
+	rule.Resources = append(append([]string{}, rule.Resources...), resources...)
+	return rule
+}
+
+// WithSubresources adds the given subresources of every resource already in
+// the rule, e.g. "pods" with "status" adds "pods/status"
+func (rule RuleWithOperations) WithSubresources(subresources ...string) RuleWithOperations {
+	resources := append([]string{}, rule.Resources...)
+	for _, resource := range rule.Resources {
+		if strings.Contains(resource, "/") {
+			continue
+		}
+		for _, subresource := range subresources {
+			resources = append(resources, resource+"/"+subresource)
+		}
+	}
+	rule.Resources = resources
+
+	return rule
+}
+
 func (rule RuleWithOperations) NamespacedScope() RuleWithOperations {
 	rule.Scope = admissionregistrationv1.NamespacedScope
 
 	return rule
 }
 
+func (rule RuleWithOperations) ClusterScope() RuleWithOperations {
+	rule.Scope = admissionregistrationv1.ClusterScope
+
+	return rule
+}
+
+func (rule RuleWithOperations) AllScopes() RuleWithOperations {
+	rule.Scope = admissionregistrationv1.AllScopes
+
+	return rule
+}
+
 func (rule RuleWithOperations) ForCreate() RuleWithOperations {
 	rule.Operations = append(rule.Operations, admissionregistrationv1.Create)
 	return rule
@@ -71,3 +132,31 @@ func (rule RuleWithOperations) ForAll() RuleWithOperations {
 	rule.Operations = append(rule.Operations, admissionregistrationv1.OperationAll)
 	return rule
 }
+
+// ForOperations adds the given operations to the rule
+func (rule RuleWithOperations) ForOperations(operations ...admissionregistrationv1.OperationType) RuleWithOperations {
+	rule.Operations = append(append([]admissionregistrationv1.OperationType{}, rule.Operations...), operations...)
+	return rule
+}
+
+// toAdmissionRules converts the rules into the k8s.io/api/admissionregistration/v1
+// types used by the webhook configurations
+func toAdmissionRules(rules []RuleWithOperations) []admissionregistrationv1.RuleWithOperations {
+	result := make([]admissionregistrationv1.RuleWithOperations, 0, len(rules))
+	for _, rule := range rules {
+		admissionRule := admissionregistrationv1.RuleWithOperations{
+			Operations: rule.Operations,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   rule.APIGroups,
+				APIVersions: rule.APIVersions,
+				Resources:   rule.Resources,
+			},
+		}
+		if rule.Scope != "" {
+			scope := rule.Scope
+			admissionRule.Scope = &scope
+		}
+		result = append(result, admissionRule)
+	}
+	return result
+}
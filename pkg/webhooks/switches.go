@@ -0,0 +1,219 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// switchRetryPeriod is the delay before reconciling the webhook configurations
+// again, after failing to apply a switch
+const switchRetryPeriod = 10 * time.Second
+
+// IsEnabled returns whether the webhook is enabled. Webhooks without a Switch
+// are always enabled, the rest default to !Disabled until they are switched
+// with SetSwitches
+func (webhookConfig *CSWebhookConfig) IsEnabled(webhook CSWebhook) bool {
+	if webhook.Switch == "" {
+		return true
+	}
+
+	webhookConfig.switchesMu.RLock()
+	defer webhookConfig.switchesMu.RUnlock()
+	if enabled, ok := webhookConfig.switches[webhook.Switch]; ok {
+		return enabled
+	}
+	return !webhook.Disabled
+}
+
+// SetSwitches sets the state of the webhooks from data, the keys being their
+// Switch and the values booleans. The webhooks missing from data get back to
+// their default state. It returns whether the state of any webhook changed,
+// and the errors of the values that can't be parsed, which are ignored
+func (webhookConfig *CSWebhookConfig) SetSwitches(data map[string]string) (bool, error) {
+	switches := make(map[string]bool, len(data))
+	var err error
+	for key, value := range data {
+		enabled, parseErr := strconv.ParseBool(value)
+		if parseErr != nil {
+			err = fmt.Errorf("invalid value %q of switch %s, expected true or false", value, key)
+			continue
+		}
+		switches[key] = enabled
+	}
+
+	before := webhookConfig.enabledSwitches()
+	webhookConfig.switchesMu.Lock()
+	webhookConfig.switches = switches
+	webhookConfig.switchesMu.Unlock()
+	after := webhookConfig.enabledSwitches()
+
+	changed := false
+	for key, enabled := range after {
+		if before[key] != enabled {
+			log.Info("Switched webhook", "switch", key, "enabled", enabled)
+			changed = true
+		}
+	}
+	return changed, err
+}
+
+// enabledSwitches returns the state of each switch of webhookConfig.Webhooks
+func (webhookConfig *CSWebhookConfig) enabledSwitches() map[string]bool {
+	state := map[string]bool{}
+	for _, webhook := range webhookConfig.Webhooks {
+		if webhook.Switch != "" {
+			state[webhook.Switch] = webhookConfig.IsEnabled(webhook)
+		}
+	}
+	return state
+}
+
+// SwitchedHandler allows every admission request without calling Handler
+// while Enabled returns false
+// +k8s:deepcopy-gen=false
+type SwitchedHandler struct {
+	Enabled func() bool
+	Handler admission.Handler
+}
+
+// Handle calls the wrapped handler if it's enabled
+func (h *SwitchedHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if !h.Enabled() {
+		logf.FromContext(ctx).V(1).Info("Webhook is disabled")
+		return admission.Allowed("webhook is disabled")
+	}
+	return h.Handler.Handle(ctx, req)
+}
+
+// InjectDecoder injects the decoder into the wrapped handler
+func (h *SwitchedHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
+// InjectFunc injects the dependencies into the wrapped handler
+func (h *SwitchedHandler) InjectFunc(f inject.Func) error {
+	return f(h.Handler)
+}
+
+// SwitchesWatcher watches the switches ConfigMap and sets the state of the
+// webhooks from its data. It runs in every replica, as all of them serve the
+// admission requests, and once elected it reconciles the webhook
+// configurations on every switch, so the disabled webhooks are no longer
+// called by the API server
+// +k8s:deepcopy-gen=false
+type SwitchesWatcher struct {
+	WebhookConfig *CSWebhookConfig
+
+	// ConfigMap is the name of the switches ConfigMap, in the namespace of the
+	// webhook server
+	ConfigMap string
+
+	// Clientset watches the switches ConfigMap
+	Clientset kubernetes.Interface
+
+	// Client reconciles the webhook configurations. It must not rely on the
+	// cache, as the watcher doesn't wait for it
+	Client k8sclient.Client
+
+	// Elected is closed once this replica is the leader
+	Elected <-chan struct{}
+}
+
+// NeedLeaderElection returns false, so every replica watches the switches
+func (w *SwitchesWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start watches the switches ConfigMap until ctx is done
+func (w *SwitchesWatcher) Start(ctx context.Context) error {
+	logger := log.WithValues("ConfigMap", w.ConfigMap, "namespace", w.WebhookConfig.Namespace)
+	reconcile := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case reconcile <- struct{}{}:
+		default:
+		}
+	}
+
+	update := func(data map[string]string) {
+		changed, err := w.WebhookConfig.SetSwitches(data)
+		if err != nil {
+			logger.Error(err, "Failed to parse the webhook switches")
+		}
+		if changed {
+			trigger()
+		}
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(w.Clientset, 0,
+		informers.WithNamespace(w.WebhookConfig.Namespace),
+		informers.WithTweakListOptions(func(options *v1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", w.ConfigMap).String()
+		}),
+	)
+	factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cm, ok := obj.(*corev1.ConfigMap); ok {
+				update(cm.Data)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if cm, ok := obj.(*corev1.ConfigMap); ok {
+				update(cm.Data)
+			}
+		},
+		DeleteFunc: func(_ interface{}) {
+			update(nil)
+		},
+	})
+	logger.Info("Watching the webhook switches")
+	factory.Start(ctx.Done())
+
+	select {
+	case <-w.Elected:
+	case <-ctx.Done():
+		return nil
+	}
+	for {
+		select {
+		case <-reconcile:
+			logger.Info("Reconciling the webhook configurations after a switch")
+			if err := w.WebhookConfig.Reconcile(logf.IntoContext(ctx, logger), w.Client, nil); err != nil {
+				logger.Error(err, "Failed to reconcile the webhook configurations, retrying", "after", switchRetryPeriod)
+				time.AfterFunc(switchRetryPeriod, trigger)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,181 @@
+//
+// Copyright 2022 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhooks
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestSetSwitches(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        map[string]string
+		wantEnabled map[string]bool
+		wantChanged bool
+		wantErr     bool
+	}{
+		{
+			name:        "defaults",
+			wantEnabled: map[string]bool{"always": true, "opt-out": true, "opt-in": false},
+		},
+		{
+			name:        "switched",
+			data:        map[string]string{"opt-out": "false", "opt-in": "true"},
+			wantEnabled: map[string]bool{"always": true, "opt-out": false, "opt-in": true},
+			wantChanged: true,
+		},
+		{
+			name:        "same as the defaults",
+			data:        map[string]string{"opt-out": "true", "opt-in": "false"},
+			wantEnabled: map[string]bool{"always": true, "opt-out": true, "opt-in": false},
+		},
+		{
+			name:        "garbage is ignored",
+			data:        map[string]string{"opt-out": "disabled", "opt-in": "true"},
+			wantEnabled: map[string]bool{"always": true, "opt-out": true, "opt-in": true},
+			wantChanged: true,
+			wantErr:     true,
+		},
+		{
+			name:        "unknown switch",
+			data:        map[string]string{"other": "false"},
+			wantEnabled: map[string]bool{"always": true, "opt-out": true, "opt-in": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhookConfig := NewCSWebhookConfig(Options{})
+			webhooks := map[string]CSWebhook{
+				"always":  {WebhookName: "always"},
+				"opt-out": {WebhookName: "opt-out", Switch: "opt-out"},
+				"opt-in":  {WebhookName: "opt-in", Switch: "opt-in", Disabled: true},
+			}
+			for _, webhook := range webhooks {
+				webhookConfig.AddWebhook(webhook)
+			}
+
+			changed, err := webhookConfig.SetSwitches(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetSwitches() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("SetSwitches() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			for name, want := range tt.wantEnabled {
+				if got := webhookConfig.IsEnabled(webhooks[name]); got != want {
+					t.Errorf("IsEnabled(%s) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("back to the defaults", func(t *testing.T) {
+		webhookConfig := NewCSWebhookConfig(Options{})
+		webhook := CSWebhook{WebhookName: "opt-in", Switch: "opt-in", Disabled: true}
+		webhookConfig.AddWebhook(webhook)
+		if _, err := webhookConfig.SetSwitches(map[string]string{"opt-in": "true"}); err != nil {
+			t.Fatal(err)
+		}
+		changed, err := webhookConfig.SetSwitches(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed || webhookConfig.IsEnabled(webhook) {
+			t.Errorf("SetSwitches(nil) changed = %v, enabled = %v, want true, false", changed, webhookConfig.IsEnabled(webhook))
+		}
+	})
+}
+
+// recordingHandler records whether it has been called
+type recordingHandler struct {
+	called bool
+}
+
+func (h *recordingHandler) Handle(_ context.Context, _ admission.Request) admission.Response {
+	h.called = true
+	return admission.Denied("denied by the handler")
+}
+
+func TestSwitchedHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		wantAllowed bool
+	}{
+		{name: "enabled", enabled: true, wantAllowed: false},
+		{name: "disabled", enabled: false, wantAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &recordingHandler{}
+			switched := &SwitchedHandler{
+				Enabled: func() bool { return tt.enabled },
+				Handler: handler,
+			}
+			resp := switched.Handle(context.TODO(), admission.Request{})
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("Handle() allowed = %v, want %v", resp.Allowed, tt.wantAllowed)
+			}
+			if handler.called != tt.enabled {
+				t.Errorf("handler called = %v, want %v", handler.called, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestReconcilePrunesSwitchedOffWebhook(t *testing.T) {
+	certDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(certDir, "ca.crt"), []byte("ca"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	webhookConfig := NewCSWebhookConfig(Options{CertProvider: CertProviderManual, CertDir: certDir})
+	webhookConfig.AddWebhook(CSWebhook{
+		Name:        "ibm-operandrequest-webhook-configuration",
+		WebhookName: "operandrequest.operator.ibm.com",
+		Switch:      "operandrequest",
+	})
+	client := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+		mutatingConfiguration("ibm-operandrequest-webhook-configuration", managedLabels, "operandrequest.operator.ibm.com"),
+	).Build()
+
+	changed, err := webhookConfig.SetSwitches(map[string]string{"operandrequest": "false"})
+	if err != nil || !changed {
+		t.Fatalf("SetSwitches() = %v, %v, want true, nil", changed, err)
+	}
+	if err := webhookConfig.Reconcile(context.TODO(), client, nil); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	list := &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	if err := client.List(context.TODO(), list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("configurations = %d, want the switched off one to be pruned", len(list.Items))
+	}
+}
@@ -26,6 +26,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/IBM/ibm-common-service-webhook/pkg/audit"
+	"github.com/IBM/ibm-common-service-webhook/pkg/metrics"
+	"github.com/IBM/ibm-common-service-webhook/pkg/tracing"
 )
 
 // WebhookRegister knows how the register a webhook into the server. Either by
@@ -155,12 +159,32 @@ func (awr AdmissionWebhookRegister) RegisterToBuilder(bldr *builder.WebhookBuild
 	return bldr
 }
 
-// RegisterToServer regsiters the webhook to the path of `awr`
+// RegisterToServer regsiters the webhook to the path of `awr`. The handler is
+// wrapped by wrapHandler. A path ending with "/" serves the requests of every
+// path under it
 func (awr AdmissionWebhookRegister) RegisterToServer(scheme *runtime.Scheme, srv *webhook.Server) {
+	awr.Hook.Handler = wrapHandler(strings.Trim(awr.Path, "/"), awr.Hook.Handler)
 	awr.Hook.InjectScheme(scheme)
 	srv.Register(awr.Path, awr.Hook)
 }
 
+// wrapHandler instruments handler to record the admission metrics under name,
+// to trace and audit its admission requests, and to get a logger correlated to
+// the admission request in its context
+func wrapHandler(name string, handler admission.Handler) admission.Handler {
+	return metrics.InstrumentHandler(name, &tracing.TracedHandler{
+		Name: name,
+		Handler: &LoggingHandler{
+			Name: name,
+			Handler: &audit.AuditedHandler{
+				Name:    name,
+				Handler: handler,
+				Trail:   audit.DefaultTrail,
+			},
+		},
+	})
+}
+
 // GetReconciler creates a reconciler for awr's given Path and Type
 func (awr AdmissionWebhookRegister) GetReconciler(_ *runtime.Scheme) (WebhookReconciler, error) {
 	switch awr.Type {